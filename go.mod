@@ -3,6 +3,8 @@ module github.com/bokwoon95/wgo
 go 1.16
 
 require (
+	github.com/creack/pty v1.1.18
 	github.com/fsnotify/fsnotify v1.6.0
 	github.com/google/go-cmp v0.5.9
+	golang.org/x/sys v0.0.0-20220908164124-27713097b956
 )
@@ -5,11 +5,13 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
+
+	"github.com/bokwoon95/wgo/watcher"
 )
 
 const helptext = `Usage:
@@ -25,7 +27,30 @@ const helptext = `Usage:
   wgo run -file .html . arg1 arg2 arg3
   wgo run -file=.css -file=.js -tags=fts5 ./cmd/my_project arg1 arg2 arg3
 
-Pass in the -h flag to the wgo/wgo run to learn what flags there are i.e. wgo -h, wgo run -h
+  wgo debug [FLAGS] [GO_BUILD_FLAGS] <package> [ARGUMENTS...]
+  wgo debug main.go
+  wgo debug -dlv-listen :2345 main.go arg1 arg2 arg3
+
+  wgo ctl [FLAGS] <command> [ARGUMENTS...]
+  wgo ctl restart
+  wgo ctl status
+  wgo stats
+  wgo last-error
+
+  wgo serve [FLAGS] [DIR]
+  wgo serve ./public
+
+  wgo match [FLAGS] <path> [PATHS...]
+  wgo match -file .css -xdir vendor styles.css vendor/bootstrap.css
+
+  wgo run -record events.log main.go
+  wgo replay events.log run main.go
+
+  wgo -daemon run main.go
+  wgo status
+  wgo stop
+
+Pass in the -h flag to the wgo/wgo run/wgo debug/wgo ctl/wgo stats/wgo last-error/wgo serve/wgo match to learn what flags there are i.e. wgo -h, wgo run -h, wgo debug -h, wgo ctl -h, wgo stats -h, wgo last-error -h, wgo serve -h, wgo match -h
 
 Core documentation resides at https://github.com/bokwoon95/wgo#quickstart
 `
@@ -36,6 +61,38 @@ func main() {
 		return
 	}
 
+	// `wgo ctl`, `wgo stats`, `wgo last-error`, `wgo status` and `wgo stop`
+	// talk to an already running wgo instead of running commands, `wgo serve`
+	// serves files and `wgo match` tests paths against the file matching
+	// flags.
+	var subcommand func(args []string, stdout io.Writer) error
+	switch os.Args[1] {
+	case "ctl":
+		subcommand = watcher.WgoCtl
+	case "stats":
+		subcommand = watcher.WgoStats
+	case "last-error":
+		subcommand = watcher.WgoLastError
+	case "status":
+		subcommand = watcher.WgoStatus
+	case "stop":
+		subcommand = watcher.WgoStop
+	case "serve":
+		subcommand = watcher.WgoServe
+	case "match":
+		subcommand = watcher.WgoMatch
+	}
+	if subcommand != nil {
+		err := subcommand(os.Args[2:], os.Stdout)
+		if err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			log.Fatal(err)
+		}
+		return
+	}
+
 	userInterrupt := make(chan os.Signal, 1)
 	signal.Notify(userInterrupt, syscall.SIGTERM, syscall.SIGINT)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -47,40 +104,9 @@ func main() {
 		os.Exit(1)
 	}()
 
-	// Construct the list of WgoCmds from os.Args.
-	wgoCmds, err := WgoCommands(ctx, os.Args)
-	if err != nil {
-		if errors.Is(err, flag.ErrHelp) {
-			return
-		}
-		log.Fatal(err)
-	}
-
-	// Run the WgoCmds in parallel.
-	results := make(chan error, len(wgoCmds))
-	var wg sync.WaitGroup
-	for _, wgoCmd := range wgoCmds {
-		wgoCmd := wgoCmd
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			results <- wgoCmd.Run()
-		}()
-	}
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
-	// Wait for results.
-	ok := true
-	for err := range results {
-		if err != nil {
-			fmt.Println(err)
-			ok = false
-		}
-	}
-	if !ok {
-		os.Exit(1)
+	// Run the wgo commands (see watcher.Main).
+	exitCode := watcher.Main(ctx, os.Args)
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
 }
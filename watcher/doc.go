@@ -0,0 +1,22 @@
+// Package watcher is the engine of wgo: it watches directories for file
+// events, matches the changed files against the -file, -xfile, -dir and -xdir
+// patterns and (re)runs a chain of commands, exactly like the wgo command line
+// tool. Programs can import it to embed the reload loop instead of shelling
+// out to the wgo binary.
+//
+// A WgoCmd is created from the same args as the command line (without the
+// leading "wgo") and runs until its context is canceled:
+//
+//	wgoCmd, err := watcher.WgoCommand(ctx, []string{"run", "-file", ".html", "."})
+//	if err != nil {
+//		return err
+//	}
+//	wgoCmd.Stdout = logWriter
+//	wgoCmd.Stderr = logWriter
+//	err = wgoCmd.Run()
+//
+// WgoCommands creates parallel WgoCmds from the args separated by ":: wgo",
+// and Main runs them the way the wgo command line tool does. The subcommands
+// of wgo are implemented by WgoCtl, WgoStats, WgoLastError, WgoStatus, WgoStop,
+// WgoServe and WgoMatch.
+package watcher
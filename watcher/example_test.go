@@ -0,0 +1,26 @@
+package watcher_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/bokwoon95/wgo/watcher"
+)
+
+// Rebuild and restart the server in the current directory whenever a .go or
+// .html file changes, until the program is interrupted.
+func ExampleWgoCommand() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	wgoCmd, err := watcher.WgoCommand(ctx, []string{"run", "-file", ".html", "."})
+	if err != nil {
+		log.Fatal(err)
+	}
+	wgoCmd.Logger = log.New(os.Stderr, "[watcher] ", 0)
+	err = wgoCmd.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+func main() {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		log.Fatalf("LISTEN_PID is %q, want %d", os.Getenv("LISTEN_PID"), os.Getpid())
+	}
+	if os.Getenv("LISTEN_FDS") != "1" {
+		log.Fatalf("LISTEN_FDS is %q, want 1", os.Getenv("LISTEN_FDS"))
+	}
+	ln, err := net.FileListener(os.NewFile(3, os.Getenv("LISTEN_FDNAMES")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Listening on " + os.Getenv("LISTEN_FDNAMES"))
+	log.Fatal(http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "hello world")
+	})))
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+)
+
+//go:embed static templates/*.html
+var files embed.FS
+
+func main() {
+	b, err := files.ReadFile("templates/index.html")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(string(b))
+}
@@ -0,0 +1,8 @@
+//go:build never
+// +build never
+
+package main
+
+func init() {
+	panic("never.go should be excluded by its build constraint")
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A -filter script that skips test files and fails on files named crash.go.
+func main() {
+	var event struct {
+		Op   string `json:"op"`
+		Path string `json:"path"`
+		File string `json:"file"`
+	}
+	err := json.NewDecoder(os.Stdin).Decode(&event)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	switch {
+	case strings.HasSuffix(event.File, "crash.go"):
+		os.Exit(2)
+	case strings.HasSuffix(event.File, "_test.go"):
+		fmt.Println("skipping " + event.Op + " on a test file")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// hang ignores SIGINT and SIGTERM so that it has to be killed.
+func main() {
+	fmt.Println("Waiting...")
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	for range sigs {
+		fmt.Println("Ignoring signal.")
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fileinfo, err := os.Stdout.Stat()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if fileinfo.Mode()&os.ModeCharDevice != 0 {
+		fmt.Println("terminal")
+	} else {
+		fmt.Println("not a terminal")
+	}
+}
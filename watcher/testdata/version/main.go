@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+var commit, branch, dirty, buildTime string
+
+func main() {
+	fmt.Println(commit, branch, dirty, buildTime != "")
+}
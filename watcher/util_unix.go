@@ -0,0 +1,453 @@
+//go:build !windows
+// +build !windows
+
+package watcher
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+// NOTE: We shouldn't encounter the macOS file limit of 256 anymore now that
+// importing "os" automatically raises it for us in an init function.
+// https://github.com/golang/go/issues/46279
+// https://go-review.googlesource.com/c/go/+/393354/4/src/os/rlimit.go
+
+const (
+	specialChars      = "\\'\"`${[|&;<>()*?!"
+	extraSpecialChars = " \t\n"
+	prefixChars       = "~"
+)
+
+// stop stops the command and all its child processes.
+func stop(cmd *exec.Cmd) {
+	// https://stackoverflow.com/questions/22470193/why-wont-go-kill-a-child-process-correctly
+	// https://medium.com/@felixge/killing-a-child-process-and-all-of-its-children-in-go-54079af94773
+	pgid := -cmd.Process.Pid
+	_ = syscall.Kill(pgid, syscall.SIGTERM)
+}
+
+// kill forcefully kills the command and all its child processes.
+func kill(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// quit sends SIGQUIT to the command and all its child processes, which makes
+// Go programs exit with a goroutine dump.
+func quit(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGQUIT)
+}
+
+// https://stackoverflow.com/questions/22470193/why-wont-go-kill-a-child-process-correctly
+// https://medium.com/@felixge/killing-a-child-process-and-all-of-its-children-in-go-54079af94773
+func setpgid(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
+
+// detach makes the command run in its own session, so that it keeps running
+// after the terminal it was started from is closed.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+}
+
+// processExists reports whether a process with the given pid is running.
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// terminate asks the process with the given pid to exit.
+func terminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// processList returns the parent pid, the resident set size in bytes and the
+// CPU time used so far of every running process, as reported by ps.
+func processList() (parents map[int]int, memory map[int]uint64, cpu map[int]time.Duration, err error) {
+	output, err := exec.Command("ps", "-A", "-o", "pid=", "-o", "ppid=", "-o", "rss=", "-o", "time=").Output()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	parents = make(map[int]int)
+	memory = make(map[int]uint64)
+	cpu = make(map[int]time.Duration)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		kilobytes, err3 := strconv.ParseUint(fields[2], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		parents[pid] = ppid
+		memory[pid] = kilobytes * 1024
+		cpu[pid] = parseCPUTime(fields[3])
+	}
+	return parents, memory, cpu, nil
+}
+
+// parseCPUTime parses the CPU time reported by ps, which is [DD-]HH:MM:SS on
+// linux and MM:SS.ss on macOS and the BSDs. It returns 0 if the time can't be
+// parsed.
+func parseCPUTime(value string) time.Duration {
+	var days int
+	if i := strings.Index(value, "-"); i >= 0 {
+		days, _ = strconv.Atoi(value[:i])
+		value = value[i+1:]
+	}
+	parts := strings.Split(value, ":")
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil {
+		return 0
+	}
+	multiplier := 60.0
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0
+		}
+		seconds += float64(n) * multiplier
+		multiplier *= 60
+	}
+	seconds += float64(days) * 24 * 60 * 60
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// closeOnExec marks a file descriptor inherited by wgo (such as a socket
+// passed by systemd) close-on-exec, so that it is only inherited by the
+// commands that it is passed to on purpose.
+func closeOnExec(fd uintptr) {
+	syscall.CloseOnExec(int(fd))
+}
+
+// passListenFiles passes the listening sockets to the command using the
+// systemd socket activation protocol (see sd_listen_fds(3)), as the file
+// descriptors starting from 3. The command is wrapped in sh so that LISTEN_PID
+// can be set to the PID of the command itself.
+func passListenFiles(cmd *exec.Cmd, files []*os.File, names []string) error {
+	shPath, err := exec.LookPath("sh")
+	if err != nil {
+		return err
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env, "LISTEN_FDS="+strconv.Itoa(len(files)), "LISTEN_FDNAMES="+strings.Join(names, ":"))
+	cmd.ExtraFiles = files
+	cmd.Args = append([]string{"sh", "-c", `export LISTEN_PID=$$; exec "$0" "$@"`, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = shPath
+	return nil
+}
+
+// setPriority sets the scheduling priority of the process group of the
+// command with the given pid.
+func setPriority(pid, nice int) error {
+	return unix.Setpriority(unix.PRIO_PGRP, pid, nice)
+}
+
+// setRlimits applies the resource limits (see parseRlimit) to the command. The
+// command is wrapped in sh so that the limits can be set with ulimit just
+// before the command is executed.
+func setRlimits(cmd *exec.Cmd, rlimits []string) error {
+	shPath, err := exec.LookPath("sh")
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, rlimit := range rlimits {
+		option, limit, err := parseRlimit(rlimit)
+		if err != nil {
+			return err
+		}
+		b.WriteString("ulimit " + option + " " + limit + " && ")
+	}
+	b.WriteString(`exec "$0" "$@"`)
+	cmd.Args = append([]string{"sh", "-c", b.String(), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = shPath
+	return nil
+}
+
+// startPTY starts the command with its stdout and stderr (and stdin, if it
+// isn't already set) attached to a new pseudo-terminal. It returns the
+// controlling end of the pseudo-terminal, which must be closed with waitPTY().
+func startPTY(cmd *exec.Cmd) (io.ReadWriteCloser, error) {
+	// The command is put in a new session, which also gives it its own
+	// process group so stop() still works. We can't use Setpgid as well
+	// because a session leader is not allowed to change its process group.
+	attrs := &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: cmd.Stdin == nil,
+	}
+	size, err := pty.GetsizeFull(os.Stdout)
+	if err != nil {
+		size = nil
+	}
+	ptmx, err := pty.StartWithAttrs(cmd, size, attrs)
+	if err != nil {
+		return nil, err
+	}
+	return ptmx, nil
+}
+
+// waitPTY closes the pseudo-terminal once the command has exited and its
+// output has been fully copied (signalled by outputDone).
+func waitPTY(ptmx io.ReadWriteCloser, outputDone <-chan struct{}) {
+	<-outputDone
+	ptmx.Close()
+}
+
+// resizePTY resizes the pseudo-terminal to match the size of the terminal wgo
+// is running in.
+func resizePTY(ptmx io.ReadWriteCloser) error {
+	file, ok := ptmx.(*os.File)
+	if !ok {
+		return nil
+	}
+	return pty.InheritSize(os.Stdout, file)
+}
+
+// pauseSignal and resumeSignal are the signals that pause and resume watching
+// for file events.
+var (
+	pauseSignal  os.Signal = syscall.SIGUSR1
+	resumeSignal os.Signal = syscall.SIGUSR2
+)
+
+// forwardSignals are the signals that -forward-signals forwards to the
+// commands.
+var forwardSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2}
+
+// signalGroup sends the signal to the command and all its child processes.
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+}
+
+// notifyResize sends a value on the channel whenever the terminal wgo is
+// running in is resized (SIGWINCH). Calling the returned function stops the
+// notifications.
+func notifyResize(resized chan<- struct{}) (stop func()) {
+	sigwinch := make(chan os.Signal, 1)
+	signal.Notify(sigwinch, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigwinch:
+				select {
+				case resized <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigwinch)
+		close(done)
+	}
+}
+
+// isTerminal reports whether the file is a terminal.
+func isTerminal(file *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(file.Fd()), ioctlReadTermios)
+	return err == nil
+}
+
+// terminalSize returns the width and height of the terminal, in characters.
+func terminalSize(file *os.File) (width, height int, ok bool) {
+	winsize, err := unix.IoctlGetWinsize(int(file.Fd()), unix.TIOCGWINSZ)
+	if err != nil || winsize.Col == 0 || winsize.Row == 0 {
+		return 0, 0, false
+	}
+	return int(winsize.Col), int(winsize.Row), true
+}
+
+// supportsColor reports whether the file is a terminal that understands the
+// escape sequences for colors.
+func supportsColor(file *os.File) bool {
+	return isTerminal(file) && os.Getenv("TERM") != "dumb"
+}
+
+// setCbreakMode puts the terminal into cbreak mode, where each keypress is
+// available to be read immediately without being echoed. Unlike raw mode,
+// Ctrl-C still sends SIGINT. It returns a function that restores the terminal
+// to its previous mode. It fails if the file is not a terminal.
+func setCbreakMode(file *os.File) (restore func(), err error) {
+	fd := int(file.Fd())
+	termios, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	oldTermios := *termios
+	termios.Lflag &^= unix.ICANON | unix.ECHO
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+	err = unix.IoctlSetTermios(fd, ioctlWriteTermios, termios)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		_ = unix.IoctlSetTermios(fd, ioctlWriteTermios, &oldTermios)
+	}, nil
+}
+
+// clearScreen clears the terminal screen and its scrollback.
+func clearScreen(w io.Writer) {
+	_, _ = io.WriteString(w, "\x1b[H\x1b[2J\x1b[3J")
+}
+
+// joinArgs joins the arguments of the command into a string which can then be
+// passed to `exec.Command("sh", "-c", $STRING)`. Examples:
+//
+// ["echo", "foo"] => echo foo
+//
+// ["echo", "hello goodbye"] => echo 'hello goodbye'
+func joinArgs(args []string) string {
+	// https://github.com/kballard/go-shellquote/blob/master/quote.go
+	//
+	// Copyright (C) 2014 Kevin Ballard
+	//
+	// Permission is hereby granted, free of charge, to any person obtaining
+	// a copy of this software and associated documentation files (the "Software"),
+	// to deal in the Software without restriction, including without limitation
+	// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	// and/or sell copies of the Software, and to permit persons to whom the
+	// Software is furnished to do so, subject to the following conditions:
+	//
+	// The above copyright notice and this permission notice shall be included
+	// in all copies or substantial portions of the Software.
+	//
+	// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+	// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+	// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+	var buf bytes.Buffer
+	for i, arg := range args {
+		if i != 0 {
+			buf.WriteByte(' ')
+		}
+		quote(arg, &buf)
+	}
+	return buf.String()
+}
+
+func quote(word string, buf *bytes.Buffer) {
+	// https://github.com/kballard/go-shellquote/blob/master/quote.go
+	//
+	// Copyright (C) 2014 Kevin Ballard
+	//
+	// Permission is hereby granted, free of charge, to any person obtaining
+	// a copy of this software and associated documentation files (the "Software"),
+	// to deal in the Software without restriction, including without limitation
+	// the rights to use, copy, modify, merge, publish, distribute, sublicense,
+	// and/or sell copies of the Software, and to permit persons to whom the
+	// Software is furnished to do so, subject to the following conditions:
+	//
+	// The above copyright notice and this permission notice shall be included
+	// in all copies or substantial portions of the Software.
+	//
+	// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND,
+	// EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES
+	// OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+	// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM,
+	// DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+	// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE
+	// OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+	// We want to try to produce a "nice" output. As such, we will
+	// backslash-escape most characters, but if we encounter a space, or if we
+	// encounter an extra-special char (which doesn't work with
+	// backslash-escaping) we switch over to quoting the whole word. We do this
+	// with a space because it's typically easier for people to read multi-word
+	// arguments when quoted with a space rather than with ugly backslashes
+	// everywhere.
+	origLen := buf.Len()
+
+	if len(word) == 0 {
+		// oops, no content
+		buf.WriteString("''")
+		return
+	}
+
+	cur, prev := word, word
+	atStart := true
+	for len(cur) > 0 {
+		c, l := utf8.DecodeRuneInString(cur)
+		cur = cur[l:]
+		if strings.ContainsRune(specialChars, c) || (atStart && strings.ContainsRune(prefixChars, c)) {
+			// copy the non-special chars up to this point
+			if len(cur) < len(prev) {
+				buf.WriteString(prev[0 : len(prev)-len(cur)-l])
+			}
+			buf.WriteByte('\\')
+			buf.WriteRune(c)
+			prev = cur
+		} else if strings.ContainsRune(extraSpecialChars, c) {
+			// start over in quote mode
+			buf.Truncate(origLen)
+			goto quote
+		}
+		atStart = false
+	}
+	if len(prev) > 0 {
+		buf.WriteString(prev)
+	}
+	return
+
+quote:
+	// quote mode
+	// Use single-quotes, but if we find a single-quote in the word, we need
+	// to terminate the string, emit an escaped quote, and start the string up
+	// again
+	inQuote := false
+	for len(word) > 0 {
+		i := strings.IndexRune(word, '\'')
+		if i == -1 {
+			break
+		}
+		if i > 0 {
+			if !inQuote {
+				buf.WriteByte('\'')
+				inQuote = true
+			}
+			buf.WriteString(word[0:i])
+		}
+		word = word[i+1:]
+		if inQuote {
+			buf.WriteByte('\'')
+			inQuote = false
+		}
+		buf.WriteString("\\'")
+	}
+	if len(word) > 0 {
+		if !inQuote {
+			buf.WriteByte('\'')
+		}
+		buf.WriteString(word)
+		buf.WriteByte('\'')
+	}
+}
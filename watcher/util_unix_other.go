@@ -0,0 +1,12 @@
+//go:build aix || linux || solaris || zos
+// +build aix linux solaris zos
+
+package watcher
+
+import "golang.org/x/sys/unix"
+
+// ioctl requests for reading and writing the terminal attributes.
+const (
+	ioctlReadTermios  = unix.TCGETS
+	ioctlWriteTermios = unix.TCSETS
+)
@@ -1,9 +1,15 @@
 //go:build !windows
 // +build !windows
 
-package main
+package watcher
 
-import "testing"
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
 
 func Test_joinArgs(t *testing.T) {
 	type TestTable struct {
@@ -69,3 +75,51 @@ func Test_joinArgs(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseCPUTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"00:00:00", 0},
+		{"00:01:02", 62 * time.Second},
+		{"01:00:00", time.Hour},
+		{"2-03:04:05", 51*time.Hour + 4*time.Minute + 5*time.Second},
+		{"0:01.50", 1500 * time.Millisecond},
+		{"12:34.00", 12*time.Minute + 34*time.Second},
+		{"foo", 0},
+	}
+	for _, tt := range tests {
+		got := parseCPUTime(tt.value)
+		if got != tt.want {
+			t.Errorf("%s\ngot:  %s\nwant: %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func Test_closeOnExec(t *testing.T) {
+	// syscall.Pipe doesn't set close-on-exec, like the file descriptors that
+	// systemd passes to wgo.
+	var fds [2]int
+	err := syscall.Pipe(fds[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+	closeOnExec(uintptr(fds[0]))
+	flags, err := unix.FcntlInt(uintptr(fds[0]), unix.F_GETFD, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&unix.FD_CLOEXEC == 0 {
+		t.Error("file descriptor is not close-on-exec")
+	}
+	flags, err = unix.FcntlInt(uintptr(fds[1]), unix.F_GETFD, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&unix.FD_CLOEXEC != 0 {
+		t.Error("the other end of the pipe should not be close-on-exec")
+	}
+}
@@ -0,0 +1,512 @@
+//go:build windows
+// +build windows
+
+package watcher
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// https://learn.microsoft.com/en-us/windows/console/creating-a-pseudoconsole-session
+var (
+	kernel32                = windows.NewLazySystemDLL("kernel32.dll")
+	procCreatePseudoConsole = kernel32.NewProc("CreatePseudoConsole")
+	procResizePseudoConsole = kernel32.NewProc("ResizePseudoConsole")
+	procClosePseudoConsole  = kernel32.NewProc("ClosePseudoConsole")
+)
+
+// https://learn.microsoft.com/en-us/windows/win32/api/psapi/nf-psapi-getprocessmemoryinfo
+var procGetProcessMemoryInfo = kernel32.NewProc("K32GetProcessMemoryInfo")
+
+// processMemoryCounters is PROCESS_MEMORY_COUNTERS.
+type processMemoryCounters struct {
+	cb                         uint32
+	pageFaultCount             uint32
+	peakWorkingSetSize         uintptr
+	workingSetSize             uintptr
+	quotaPeakPagedPoolUsage    uintptr
+	quotaPagedPoolUsage        uintptr
+	quotaPeakNonPagedPoolUsage uintptr
+	quotaNonPagedPoolUsage     uintptr
+	pagefileUsage              uintptr
+	peakPagefileUsage          uintptr
+}
+
+const procThreadAttributePseudoConsole = 0x00020016
+
+// stop stops the command and all its child processes.
+func stop(cmd *exec.Cmd) {
+	// https://stackoverflow.com/a/44551450
+	killCmd := exec.Command("taskkill.exe", "/t", "/f", "/pid", strconv.Itoa(cmd.Process.Pid))
+	_ = killCmd.Run()
+}
+
+// kill is the same as stop on windows, which already kills the command
+// forcefully.
+func kill(cmd *exec.Cmd) {
+	stop(cmd)
+}
+
+// quit is not supported on windows, because there is no equivalent of SIGQUIT.
+func quit(cmd *exec.Cmd) error {
+	return errors.New("goroutine dumps are not supported on Windows")
+}
+
+// setpgid is a no-op on windows.
+func setpgid(cmd *exec.Cmd) {}
+
+// detach makes the command run without a console, so that it keeps running
+// after the console it was started from is closed.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: windows.DETACHED_PROCESS | windows.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// processExists reports whether a process with the given pid is running.
+func processExists(pid int) bool {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(handle)
+	var exitCode uint32
+	err = windows.GetExitCodeProcess(handle, &exitCode)
+	const stillActive = 259
+	return err == nil && exitCode == stillActive
+}
+
+// terminate kills the process with the given pid and all its child processes.
+// Windows has no equivalent of SIGTERM for console programs.
+func terminate(pid int) error {
+	return exec.Command("taskkill.exe", "/t", "/f", "/pid", strconv.Itoa(pid)).Run()
+}
+
+// processList returns the parent pid, the working set size in bytes and the
+// CPU time used so far of every running process.
+func processList() (parents map[int]int, memory map[int]uint64, cpu map[int]time.Duration, err error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer windows.CloseHandle(snapshot)
+	parents = make(map[int]int)
+	memory = make(map[int]uint64)
+	cpu = make(map[int]time.Duration)
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		pid := int(entry.ProcessID)
+		parents[pid] = int(entry.ParentProcessID)
+		handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, entry.ProcessID)
+		if err != nil {
+			continue
+		}
+		var counters processMemoryCounters
+		counters.cb = uint32(unsafe.Sizeof(counters))
+		r1, _, _ := procGetProcessMemoryInfo.Call(uintptr(handle), uintptr(unsafe.Pointer(&counters)), uintptr(counters.cb))
+		if r1 != 0 {
+			memory[pid] = uint64(counters.workingSetSize)
+		}
+		// The kernel and user times are in units of 100 nanoseconds.
+		var creationTime, exitTime, kernelTime, userTime windows.Filetime
+		if windows.GetProcessTimes(handle, &creationTime, &exitTime, &kernelTime, &userTime) == nil {
+			ticks := uint64(kernelTime.HighDateTime)<<32 | uint64(kernelTime.LowDateTime)
+			ticks += uint64(userTime.HighDateTime)<<32 | uint64(userTime.LowDateTime)
+			cpu[pid] = time.Duration(ticks * 100)
+		}
+		windows.CloseHandle(handle)
+	}
+	return parents, memory, cpu, nil
+}
+
+// closeOnExec marks a handle inherited by wgo as not inheritable, so that it
+// is only inherited by the commands that it is passed to on purpose.
+func closeOnExec(fd uintptr) {
+	syscall.CloseOnExec(syscall.Handle(fd))
+}
+
+// passListenFiles is not supported on windows, because there is no way to
+// pass extra file descriptors to a command.
+func passListenFiles(cmd *exec.Cmd, files []*os.File, names []string) error {
+	return errors.New("passing sockets to commands is not supported on Windows")
+}
+
+// setPriority sets the priority class of the process with the given pid to
+// the one closest to the nice value. Child processes started afterwards
+// inherit the below normal and idle priority classes.
+func setPriority(pid, nice int) error {
+	handle, err := windows.OpenProcess(windows.PROCESS_SET_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(handle)
+	var priorityClass uint32
+	switch {
+	case nice >= 10:
+		priorityClass = windows.IDLE_PRIORITY_CLASS
+	case nice > 0:
+		priorityClass = windows.BELOW_NORMAL_PRIORITY_CLASS
+	case nice <= -10:
+		priorityClass = windows.HIGH_PRIORITY_CLASS
+	case nice < 0:
+		priorityClass = windows.ABOVE_NORMAL_PRIORITY_CLASS
+	default:
+		priorityClass = windows.NORMAL_PRIORITY_CLASS
+	}
+	return windows.SetPriorityClass(handle, priorityClass)
+}
+
+// setRlimits is not supported on windows, because there are no resource
+// limits.
+func setRlimits(cmd *exec.Cmd, rlimits []string) error {
+	return errors.New("resource limits are not supported on Windows")
+}
+
+// conPTY is a Windows pseudo console (ConPTY).
+type conPTY struct {
+	hpc       windows.Handle
+	input     *os.File // We write to input, the pseudo console reads from it.
+	output    *os.File // The pseudo console writes to output, we read from it.
+	closeOnce sync.Once
+}
+
+func (c *conPTY) Read(p []byte) (n int, err error) { return c.output.Read(p) }
+
+func (c *conPTY) Write(p []byte) (n int, err error) { return c.input.Write(p) }
+
+func (c *conPTY) Close() error {
+	c.closeOnce.Do(func() {
+		_, _, _ = procClosePseudoConsole.Call(uintptr(c.hpc))
+		c.input.Close()
+		c.output.Close()
+	})
+	return nil
+}
+
+// startPTY starts the command attached to a new pseudo console. It returns the
+// pseudo console, which must be closed with waitPTY(). Requires Windows 10
+// version 1809 or later.
+func startPTY(cmd *exec.Cmd) (io.ReadWriteCloser, error) {
+	if cmd.Stdin != nil {
+		return nil, errors.New("-pty: the last command can't read from a pipe on windows")
+	}
+	err := procCreatePseudoConsole.Find()
+	if err != nil {
+		return nil, errors.New("-pty: ConPTY requires Windows 10 version 1809 or later")
+	}
+
+	// Create the pipes that the pseudo console reads input from and writes
+	// output to.
+	var inputRead, inputWrite, outputRead, outputWrite windows.Handle
+	err = windows.CreatePipe(&inputRead, &inputWrite, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	err = windows.CreatePipe(&outputRead, &outputWrite, nil, 0)
+	if err != nil {
+		windows.CloseHandle(inputRead)
+		windows.CloseHandle(inputWrite)
+		return nil, err
+	}
+	c := &conPTY{
+		input:  os.NewFile(uintptr(inputWrite), "|0"),
+		output: os.NewFile(uintptr(outputRead), "|1"),
+	}
+
+	// Create the pseudo console with the same size as the current console.
+	size, ok := consoleSize()
+	if !ok {
+		size = windows.Coord{X: 80, Y: 25}
+	}
+	hresult, _, _ := procCreatePseudoConsole.Call(
+		uintptr(*(*uint32)(unsafe.Pointer(&size))), // COORD is passed by value.
+		uintptr(inputRead),
+		uintptr(outputWrite),
+		0,
+		uintptr(unsafe.Pointer(&c.hpc)),
+	)
+	// The pseudo console holds its own copies of these handles.
+	windows.CloseHandle(inputRead)
+	windows.CloseHandle(outputWrite)
+	if hresult != 0 {
+		c.input.Close()
+		c.output.Close()
+		return nil, errors.New("-pty: CreatePseudoConsole failed with HRESULT 0x" + strconv.FormatUint(uint64(hresult), 16))
+	}
+
+	// os/exec doesn't let us attach a pseudo console to the process, so we
+	// have to call CreateProcess ourselves.
+	attrs, err := windows.NewProcThreadAttributeList(1)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	defer attrs.Delete()
+	// The attribute value is the HPCON itself, not a pointer to it.
+	err = attrs.Update(procThreadAttributePseudoConsole, *(*unsafe.Pointer)(unsafe.Pointer(&c.hpc)), unsafe.Sizeof(c.hpc))
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	startupInfo := &windows.StartupInfoEx{}
+	startupInfo.Cb = uint32(unsafe.Sizeof(*startupInfo))
+	// Don't let the process inherit our own std handles, it should use the
+	// pseudo console's.
+	startupInfo.Flags |= windows.STARTF_USESTDHANDLES
+	startupInfo.ProcThreadAttributeList = attrs.List()
+	appName, err := windows.UTF16PtrFromString(cmd.Path)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	commandLine, err := windows.UTF16PtrFromString(windows.ComposeCommandLine(cmd.Args))
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	var dir *uint16
+	if cmd.Dir != "" {
+		dir, err = windows.UTF16PtrFromString(cmd.Dir)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	var env *uint16
+	if cmd.Env != nil {
+		env = &createEnvBlock(cmd.Env)[0]
+	}
+	processInfo := &windows.ProcessInformation{}
+	err = windows.CreateProcess(
+		appName,
+		commandLine,
+		nil,
+		nil,
+		false,
+		windows.EXTENDED_STARTUPINFO_PRESENT|windows.CREATE_UNICODE_ENVIRONMENT,
+		env,
+		dir,
+		&startupInfo.StartupInfo,
+		processInfo,
+	)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	defer windows.CloseHandle(processInfo.Thread)
+	// Keep our process handle open until os.FindProcess has opened its own,
+	// so that the process ID can't be reused in the meantime.
+	defer windows.CloseHandle(processInfo.Process)
+	cmd.Process, err = os.FindProcess(int(processInfo.ProcessId))
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	// cmd.Wait() only needs cmd.Process to be set to work.
+	return c, nil
+}
+
+// waitPTY closes the pseudo console once the command has exited and waits for
+// its remaining output to be copied (signalled by outputDone). Unlike a unix
+// pseudo-terminal, the output pipe of a pseudo console does not reach EOF
+// until the pseudo console is closed.
+func waitPTY(ptmx io.ReadWriteCloser, outputDone <-chan struct{}) {
+	ptmx.Close()
+	<-outputDone
+}
+
+// consoleSize returns the size of the console window wgo is running in.
+func consoleSize() (size windows.Coord, ok bool) {
+	var info windows.ConsoleScreenBufferInfo
+	err := windows.GetConsoleScreenBufferInfo(windows.Handle(os.Stdout.Fd()), &info)
+	if err != nil {
+		return size, false
+	}
+	size.X = info.Window.Right - info.Window.Left + 1
+	size.Y = info.Window.Bottom - info.Window.Top + 1
+	return size, true
+}
+
+// resizePTY resizes the pseudo console to match the size of the console wgo
+// is running in.
+func resizePTY(ptmx io.ReadWriteCloser) error {
+	c, ok := ptmx.(*conPTY)
+	if !ok {
+		return nil
+	}
+	size, ok := consoleSize()
+	if !ok {
+		return nil
+	}
+	hresult, _, _ := procResizePseudoConsole.Call(uintptr(c.hpc), uintptr(*(*uint32)(unsafe.Pointer(&size))))
+	if hresult != 0 {
+		return errors.New("ResizePseudoConsole failed with HRESULT 0x" + strconv.FormatUint(uint64(hresult), 16))
+	}
+	return nil
+}
+
+// pauseSignal and resumeSignal are nil because Windows has no equivalent of
+// SIGUSR1 and SIGUSR2.
+var (
+	pauseSignal  os.Signal
+	resumeSignal os.Signal
+)
+
+// forwardSignals is nil because Windows has no equivalent of SIGHUP, SIGUSR1
+// and SIGUSR2.
+var forwardSignals []os.Signal
+
+// signalGroup is not supported on windows.
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return errors.New("sending signals to commands is not supported on Windows")
+}
+
+// notifyResize sends a value on the channel whenever the console wgo is
+// running in is resized. Windows has no SIGWINCH, so the console size is
+// polled instead. Calling the returned function stops the notifications.
+func notifyResize(resized chan<- struct{}) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		prevSize, _ := consoleSize()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				size, ok := consoleSize()
+				if !ok || size == prevSize {
+					continue
+				}
+				prevSize = size
+				select {
+				case resized <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// isTerminal reports whether the file is a console.
+func isTerminal(file *os.File) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(file.Fd()), &mode) == nil
+}
+
+// terminalSize returns the width and height of the console window, in
+// characters.
+func terminalSize(file *os.File) (width, height int, ok bool) {
+	var info windows.ConsoleScreenBufferInfo
+	err := windows.GetConsoleScreenBufferInfo(windows.Handle(file.Fd()), &info)
+	if err != nil {
+		return 0, 0, false
+	}
+	return int(info.Window.Right-info.Window.Left) + 1, int(info.Window.Bottom-info.Window.Top) + 1, true
+}
+
+// supportsColor reports whether the file is a console that understands the
+// escape sequences for colors, enabling virtual terminal processing on it if
+// necessary.
+func supportsColor(file *os.File) bool {
+	handle := windows.Handle(file.Fd())
+	var mode uint32
+	if windows.GetConsoleMode(handle, &mode) != nil {
+		return false
+	}
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
+
+// setCbreakMode puts the console into a mode where each keypress is available
+// to be read immediately without being echoed. Ctrl-C is still processed by
+// the system. It returns a function that restores the console to its previous
+// mode. It fails if the file is not a console.
+func setCbreakMode(file *os.File) (restore func(), err error) {
+	handle := windows.Handle(file.Fd())
+	var mode uint32
+	err = windows.GetConsoleMode(handle, &mode)
+	if err != nil {
+		return nil, err
+	}
+	err = windows.SetConsoleMode(handle, mode&^(windows.ENABLE_LINE_INPUT|windows.ENABLE_ECHO_INPUT))
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		_ = windows.SetConsoleMode(handle, mode)
+	}, nil
+}
+
+// clearScreen clears the console screen and its scrollback. Virtual terminal
+// processing is enabled on the console first so that the escape sequences are
+// understood.
+func clearScreen(w io.Writer) {
+	handle := windows.Handle(os.Stdout.Fd())
+	var mode uint32
+	if windows.GetConsoleMode(handle, &mode) == nil {
+		_ = windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+	}
+	_, _ = io.WriteString(w, "\x1b[H\x1b[2J\x1b[3J")
+}
+
+// createEnvBlock converts a list of "KEY=VALUE" entries into the
+// null-terminated block of null-terminated UTF-16 strings that CreateProcess
+// expects.
+func createEnvBlock(env []string) []uint16 {
+	var block []uint16
+	for _, entry := range env {
+		block = append(block, utf16.Encode([]rune(entry))...)
+		block = append(block, 0)
+	}
+	if len(block) == 0 {
+		block = append(block, 0)
+	}
+	return append(block, 0)
+}
+
+// joinArgs joins the arguments of the command into a string which can then be
+// passed to `exec.Command("pwsh.exe", "-command", $STRING)`. Examples:
+//
+// ["echo", "foo"] => echo foo
+//
+// ["echo", "hello goodbye"] => echo 'hello goodbye'
+func joinArgs(args []string) string {
+	// references:
+	// https://www.rlmueller.net/PowerShellEscape.htm
+	// https://stackoverflow.com/a/11231504
+	var b strings.Builder
+	for i, arg := range args {
+		if i == 0 {
+			b.WriteString(arg)
+			continue
+		}
+		b.WriteString(" ")
+		if arg == "" {
+			b.WriteString("''")
+			continue
+		}
+		if !strings.ContainsAny(arg, " '`$(){}<>|&;*") {
+			b.WriteString(arg)
+			continue
+		}
+		b.WriteString("'" + strings.ReplaceAll(arg, "'", "''") + "'")
+	}
+	return b.String()
+}
@@ -0,0 +1,5572 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"io/fs"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// String flag names copied from `go help build`.
+var strFlagNames = []string{
+	"p", "asmflags", "buildmode", "compiler", "gccgoflags", "gcflags",
+	"installsuffix", "ldflags", "mod", "modfile", "overlay", "pkgdir",
+	"tags", "toolexec", "exec",
+}
+
+// Bool flag names copied from `go help build`.
+var boolFlagNames = []string{
+	"a", "n", "race", "msan", "asan", "v", "work", "x", "buildvcs",
+	"linkshared", "modcacherw", "trimpath",
+}
+
+var defaultLogger = log.New(io.Discard, "", 0)
+
+func init() {
+	rand.Seed(time.Now().Unix())
+}
+
+// WgoCmd implements the `wgo` command. It watches the Roots for file events
+// and (re)runs the chain of commands in ArgsList whenever a file that matches
+// changes. A WgoCmd must be created by WgoCommand or WgoCommands, after which
+// its exported fields may be changed until Run is called.
+type WgoCmd struct {
+	// The root directories to watch for changes in. Earlier roots have higher
+	// precedence than later roots (used during file matching).
+	Roots []string
+
+	// FileRegexps specifies the file patterns to include. They are matched
+	// against the a file's path relative to the root. File patterns are
+	// logically OR-ed together, so you can include multiple patterns at once.
+	// All patterns must use forward slash file separators, even on Windows.
+	//
+	// If no FileRegexps are provided, every file is included by default unless
+	// it is explicitly excluded by ExcludeFileRegexps.
+	FileRegexps []*regexp.Regexp
+
+	// ExcludeFileRegexps specifies the file patterns to exclude. They are
+	// matched against a file's path relative to the root. File patterns are
+	// logically OR-ed together, so you can exclude multiple patterns at once.
+	// All patterns must use forward slash separators, even on Windows.
+	//
+	// Excluded file patterns take higher precedence than included file
+	// patterns, so you can include a large group of files using an include
+	// pattern and surgically ignore specific files from that group using an
+	// exclude pattern.
+	ExcludeFileRegexps []*regexp.Regexp
+
+	// DirRegexps specifies the directory patterns to include. They are matched
+	// against a directory's path relative to the root. Directory patterns are
+	// logically OR-ed together, so you can include multiple patterns at once.
+	// All patterns must use forward slash separators, even on Windows.
+	//
+	// If no DirRegexps are provided, every directory is included by default
+	// unless it is explicitly excluded by ExcludeDirRegexps.
+	DirRegexps []*regexp.Regexp
+
+	// ExcludeDirRegexps specifies the directory patterns to exclude. They are
+	// matched against a directory's path relative to the root. Directory
+	// patterns are logically OR-ed together, so you can exclude multiple
+	// patterns at once. All patterns must use forward slash separators, even
+	// on Windows.
+	ExcludeDirRegexps []*regexp.Regexp
+
+	// If provided, Matcher decides which file events restart the commands and
+	// which directories are watched instead of the FileRegexps,
+	// ExcludeFileRegexps, DirRegexps and ExcludeDirRegexps (see
+	// DefaultMatcher).
+	Matcher Matcher
+
+	// Filter is a script that has the final say on whether a file event that
+	// matches restarts the commands. It is run for every such event with the
+	// event as a JSON object on its stdin, such as
+	// {"op":"WRITE","path":"/home/user/project/main.go","file":"main.go"}.
+	// Exit code 0 means that the event restarts the commands and exit code 1
+	// means that it is skipped. The first line of its stdout, if any, is the
+	// reason logged by Explain. The script is evaluated by the shell (sh or
+	// pwsh.exe), and if it fails in any other way the event is skipped.
+	Filter string
+
+	// If provided, Logger is used to log file events.
+	Logger *log.Logger
+
+	// ArgsList is the list of args slices. Each slice corresponds to a single
+	// command to execute and is of this form [cmd arg1 arg2 arg3...]. A slice
+	// of these commands represent the chain of commands to be executed.
+	ArgsList [][]string
+
+	// Separators holds the separator that follows each command in ArgsList,
+	// so Separators[i] sits between ArgsList[i] and ArgsList[i+1]. A missing
+	// or empty entry means the default "::" separator.
+	//
+	// "::" only runs the next command if the previous command succeeded. ":;:"
+	// runs the next command regardless of whether the previous command
+	// succeeded. ":&:" groups the commands on either side of it so that they
+	// run in parallel, and the separator following the group decides whether
+	// the next command runs once every command in the group has exited. ":|:"
+	// works like ":&:" except the stdout of the command on the left is piped
+	// into the stdin of the command on the right.
+	Separators []string
+
+	// Env sets the environment variables for the commands, on top of the
+	// environment inherited from wgo. Each entry is of the form "KEY=VALUE".
+	// Later entries override earlier ones.
+	Env []string
+
+	// Matrix fans the WgoCmd out into one WgoCmd for every combination of
+	// its entries, each with the combination added to Env. Each entry is of
+	// the form "KEY=VALUE1,VALUE2". It is only used by WgoCommands, the
+	// WgoCmds it returns have an empty Matrix.
+	Matrix []string
+
+	// EnvFiles are dotenv files whose variables are set for the commands,
+	// overriding the inherited environment. Later files override earlier
+	// files, and Env overrides all of them. The files are read again every
+	// time the commands are restarted.
+	EnvFiles []string
+
+	// EnvCmds are scripts whose output is parsed for environment variables
+	// for the commands every time the commands are started, after EnvFiles.
+	// The output is either KEY=VALUE lines (in the same format as EnvFiles)
+	// or a JSON object. Scripts are evaluated by the shell (sh or pwsh.exe).
+	EnvCmds []string
+
+	// If Expand is true, $VAR and ${VAR} references in the arguments of the
+	// commands are expanded every time the commands are started, using the
+	// environment of the commands. $$ expands to a literal $.
+	Expand bool
+
+	// If Deps is true, `wgo run` only restarts the commands when a changed .go
+	// file belongs to a package that the main package imports (directly or
+	// indirectly), according to `go list -deps`. Unless FileRegexps are
+	// provided, only the directories of those packages (and the directories
+	// matching DirRegexps) are watched.
+	Deps bool
+
+	// If Generate is true, `go generate` is run in the directories of the
+	// changed files that have //go:generate directives before the commands
+	// are restarted.
+	Generate bool
+
+	// If AutoLdflags is true, the binary of `wgo run` is built with -ldflags
+	// -X flags that set main.commit, main.branch and main.dirty to the git
+	// commit, the git branch and whether the working tree has uncommitted
+	// changes, and main.buildTime to the time of the build (RFC 3339). They
+	// are recomputed on every rebuild and added to any -ldflags passed by the
+	// user.
+	AutoLdflags bool
+
+	// SSH is a remote host (such as pi@raspberrypi or a Host from
+	// ~/.ssh/config) to run the binary of `wgo run` on. After every build the
+	// binary is copied to SSHPath on the host with scp and (re)started there
+	// with ssh, and its output is streamed back. Set GOOS and GOARCH to cross
+	// compile the binary for the host.
+	SSH string
+
+	// SSHPath is where the binary is copied to on the SSH host. Defaults to
+	// /tmp/wgo_<name of the package directory>.
+	SSHPath string
+
+	// Sync is an rsync destination (such as devbox:/srv/app or a local
+	// directory) that the matched files that changed are copied to before the
+	// commands are restarted, keeping their paths relative to the first root.
+	// A command chained after the sync can then build or restart the code on
+	// the remote machine e.g. `:: ssh devbox 'cd /srv/app && make restart'`.
+	Sync string
+
+	// ComposeRestart and ComposeUp are docker compose services that are
+	// restarted (`docker compose restart`) or rebuilt and recreated (`docker
+	// compose up --build -d`) after the commands succeed. The docker compose
+	// commands are added to the end of the command chain.
+	ComposeRestart []string
+	ComposeUp      []string
+
+	// KubeRollout is a list of Kubernetes resources (such as
+	// deployment/api) that are restarted with `kubectl rollout restart` after
+	// the commands succeed. The kubectl command is added to the end of the
+	// command chain.
+	KubeRollout []string
+
+	// Go is the go command that wgo uses to build the binary of `wgo run` and
+	// to run `go list`, `go generate` and `go tool buildid`, such as
+	// /usr/local/go1.23rc1/bin/go or gotip. Defaults to the go found in PATH.
+	Go string
+
+	// MaskRegexps match the names of environment variables and flags whose
+	// values are secrets. Secrets are replaced by REDACTED when the commands are
+	// logged. If MaskRegexps is empty, defaultMaskRegexp is used.
+	MaskRegexps []*regexp.Regexp
+
+	// If CleanEnv is true, the commands don't inherit wgo's environment
+	// variables apart from the few that most programs need to work (such as
+	// PATH and HOME, see cleanEnv) and the ones named in PassEnv.
+	CleanEnv bool
+	PassEnv  []string
+
+	// Dir specifies the working directory for the commands.
+	Dir string
+
+	// Dirs holds the working directory for each command in ArgsList,
+	// overriding Dir. A missing or empty entry means the command uses Dir.
+	Dirs []string
+
+	// Waits holds a dependency for each command in ArgsList that the command
+	// waits for before it starts, such as the server started by the command
+	// before it in a ":&:" group. A dependency is either an http:// or
+	// https:// URL (which must respond with a 2xx status code) or a TCP
+	// address like tcp://localhost:8080 (which must accept connections). A
+	// command that waits longer than ReadyTimeout (default 30 seconds) is
+	// started anyway. A missing or empty entry means the command doesn't
+	// wait.
+	Waits []string
+
+	// EnableStdin controls whether the Stdin field is used.
+	EnableStdin bool
+
+	// If StdinFiles is true, the list of files to watch is read from Stdin
+	// (one file per line, until EOF) instead of walking the Roots, similar to
+	// entr. Only events on the listed files trigger a reload, and the file
+	// and directory patterns are not consulted. It cannot be used together
+	// with EnableStdin or BroadcastStdin.
+	StdinFiles bool
+
+	// If Record is set, every file event received is written to the file at
+	// that path along with when it happened, so that `wgo replay` can feed
+	// the same sequence of events through the matcher and the commands
+	// again.
+	Record string
+
+	// If BroadcastStdin is true, Stdin is duplicated to every command instead
+	// of only the last command. It implies EnableStdin.
+	BroadcastStdin bool
+
+	// If EnableKeys is true and Stdin is a terminal, keypresses control wgo:
+	// r restarts the commands, p pauses or resumes watching for file events, c
+	// clears the screen and q quits. If EnableStdin (or BroadcastStdin) is
+	// also true the terminal is left in line mode for the commands, so the
+	// controls must instead be typed as a line on their own prefixed with a
+	// colon i.e. ":r", ":p", ":c" or ":q". Every other line is passed on to
+	// the commands.
+	EnableKeys bool
+
+	// Bind is a list of TCP addresses (e.g. localhost:8080) that wgo listens
+	// on itself and passes to the last command using the systemd socket
+	// activation protocol (LISTEN_FDS). Because wgo keeps the sockets open
+	// across restarts, clients connecting while the command is restarting
+	// wait for the new command instead of seeing "connection refused". Not
+	// supported on Windows.
+	Bind []string
+
+	// ListenFiles are listening sockets that are passed to the last command
+	// before the Bind sockets, using the systemd socket activation protocol.
+	// Each file's name is passed on in LISTEN_FDNAMES. main() sets this to
+	// the sockets that wgo itself received from systemd, if any.
+	ListenFiles []*os.File
+
+	// ControlSocket is the path of a unix socket that lets other programs on
+	// the same machine control wgo. See (*WgoCmd).controlCommand for the
+	// commands it accepts.
+	ControlSocket string
+
+	// Listen is the address of an HTTP server that lets other programs control
+	// wgo. POST /restart restarts the commands, POST /stop stops the commands
+	// (until the next file event), POST /run-once starts the commands if
+	// they are not already running and POST /rollback restarts the last
+	// command with the previous build (see KeepBuilds).
+	Listen string
+
+	// LiveReload is the address of a livereload server (e.g. :35729) that
+	// tells the browsers which loaded its /livereload.js script to reload the
+	// page whenever the last command is ready after a restart (or exits
+	// successfully, for commands that only build assets).
+	LiveReload string
+
+	// TLS makes the proxy and the livereload server serve HTTPS instead of
+	// HTTP, so that features which need a secure context (service workers,
+	// secure cookies, HTTP/2) can be tried out during development. They use
+	// the certificate in TLSCert and TLSKey (e.g. made by mkcert), or a
+	// self-signed certificate for localhost if those are empty.
+	TLS     bool
+	TLSCert string
+	TLSKey  string
+
+	// Proxy is the address of the server being developed (e.g.
+	// localhost:8080) and ProxyListen is the address of a reverse proxy to it
+	// (e.g. :3000). While the commands are restarting, the proxy holds on to
+	// incoming requests (for up to a minute) and forwards them once the last
+	// command is ready, so that the browser never sees "connection refused".
+	// If the commands fail, the requests fail with 502 Bad Gateway. If
+	// LiveReload is set, the livereload script is injected into every HTML
+	// page that goes through the proxy.
+	Proxy       string
+	ProxyListen string
+
+	// Stdin is where the last command gets its stdin input from (EnableStdin
+	// must be true).
+	Stdin io.Reader
+
+	// Stdout is where the commands write their stdout output.
+	Stdout io.Writer
+
+	// Stderr is where the commands write their stderr output.
+	Stderr io.Writer
+
+	// If PTY is true, the last command is run in a pseudo-terminal so that it
+	// behaves as if it were attached to a terminal (colored output, prompts,
+	// spinners etc). Its stdout and stderr are both written to Stdout. If
+	// EnableStdin is true, Stdin is fed to the pseudo-terminal.
+	PTY bool
+
+	// OutputFilter is a script whose stdin receives the stdout and stderr
+	// output of the commands, such as a log formatter. Its own output is
+	// written to Stdout and Stderr. The script is evaluated by the shell (sh
+	// or pwsh.exe) and keeps running across restarts. If it exits, it is
+	// started again the next time a command writes output.
+	OutputFilter string
+
+	// If MergeOutput is true, the commands write their stderr output to Stdout
+	// instead of Stderr. Both streams share the same writer so their output
+	// stays in order.
+	MergeOutput bool
+
+	// If Label is true, every line that the commands write to Stdout and
+	// Stderr is prefixed with the label of the command that wrote it: the
+	// name of its program, or "build" and the name of the package for the
+	// build and the binary of `wgo run`.
+	Label bool
+
+	// If Timestamps is true, wgo's messages (and the -verbose logs) start with
+	// the time and the time elapsed since the commands last started, such as
+	// "15:04:05.000 +1.250s". If TimestampOutput is true, so does every line
+	// of the commands' output.
+	Timestamps      bool
+	TimestampOutput bool
+
+	// LogFormat is the format of wgo's messages and logs, "text" (the
+	// default) or "json". With "json", every message and log line (including
+	// the -verbose logs, which are turned on) is written as a JSON object on
+	// its own line with the fields "time", "elapsed" (the seconds since the
+	// commands last started), "name", "event" (such as WATCH, EXECUTING,
+	// SKIP, READY or FAILED) and "msg".
+	LogFormat string
+
+	// FailureFormat is the format of build failures, "text" (the default) or
+	// "vscode". With "vscode", the file:line:col: locations of errors in the
+	// commands' output are made absolute and the builds are delimited by
+	// "BUILD START", "BUILD OK" and "BUILD FAILED" markers, for running wgo
+	// as a VS Code task with the $go problem matcher. With "github", every
+	// location of an error in the output of a failed build is reported as an
+	// ::error annotation for GitHub Actions.
+	FailureFormat string
+
+	// LogFile is a file that wgo's messages and logs are also written to. It
+	// is rotated once it grows past LogFileSize bytes (default 10MB), keeping
+	// three old log files named LogFile.1, LogFile.2 and LogFile.3. If
+	// LogFileOutput is true, the output of the commands is written to the log
+	// file as well.
+	LogFile       string
+	LogFileSize   uint64
+	LogFileOutput bool
+
+	// If Quiet is true, wgo's messages and logs are not written to Stderr
+	// (they are still written to the LogFile), so that only the output of the
+	// commands is printed.
+	Quiet bool
+
+	// If Explain is true, the Logger says why each file event was matched or
+	// skipped, such as the -file or -xfile regex responsible for it. -explain
+	// sets it and turns on -verbose.
+	Explain bool
+
+	// If Trace is true, the Logger also traces every raw file event (and why
+	// it was ignored before it got to the matcher, if it was) and every reset
+	// of the debounce timer, as "TRACE" lines. The decisions of the matcher
+	// are explained like with Explain. -vv sets it and turns on -verbose.
+	Trace bool
+
+	// If Summary is true, a one-line summary is printed every time the last
+	// command is ready: how long the chain took to start, how much of that
+	// was spent on the commands before the last one (such as go build) and
+	// on the last command getting ready, and which files triggered the
+	// restart.
+	Summary bool
+
+	// If Exit is true, WgoCmd exits once the last command exits.
+	Exit bool
+
+	// If CI is true, the commands are run once for continuous integration
+	// such as GitHub Actions. It implies Exit, and WgoCmd also exits if a
+	// command before the last one fails. The output of each command in the
+	// chain is wrapped in ::group:: and ::endgroup:: lines, and the
+	// FailureFormat defaults to "github".
+	CI bool
+
+	// If KillTimeout is not zero, commands that are still running
+	// KillTimeout after being asked to stop are killed.
+	//
+	// If DumpFile is set, the last command is sent SIGQUIT before it is
+	// killed, which makes Go programs write a goroutine dump to stderr. Its
+	// stderr is saved to DumpFile until it exits. KillTimeout defaults to 10
+	// seconds if DumpFile is set. DumpFile is not supported on Windows or
+	// with PTY.
+	KillTimeout time.Duration
+	DumpFile    string
+
+	// Rlimits are resource limits applied to the last command, as NAME=VALUE
+	// pairs like nofile=1024 or as=2GB. The supported names are listed in
+	// rlimitNames. Not supported on Windows.
+	Rlimits []string
+
+	// If Nice is not zero, the commands run at that scheduling priority, from
+	// -20 (highest) to 19 (lowest), like the nice command. On Windows the
+	// commands run with the closest priority class instead.
+	Nice int
+
+	// If ForwardSignals is true, the SIGHUP, SIGUSR1 and SIGUSR2 signals
+	// received by wgo are forwarded to the running commands, and wgo can't be
+	// paused and resumed with SIGUSR1 and SIGUSR2. Not supported on Windows.
+	ForwardSignals bool
+
+	// If Overlap is true, the old instance of the last command keeps running
+	// while the commands are restarted, and is only stopped once the new
+	// instance of the last command is ready. If the new instance is not
+	// ready within OverlapTimeout (default 30 seconds), or if any command
+	// fails before it, the new instance is stopped and the old instance
+	// keeps running.
+	//
+	// The new instance is ready once OverlapProbe responds. OverlapProbe is
+	// either an http:// or https:// URL (which must respond with a 2xx status
+	// code) or a TCP address like tcp://localhost:8080 (which must accept
+	// connections). If OverlapProbe is empty, ReadyURL is used instead. If
+	// both are empty, the new instance is ready once it has been running for
+	// a second.
+	Overlap        bool
+	OverlapProbe   string
+	OverlapTimeout time.Duration
+
+	// If KeepRunning is true, the old instance of the last command keeps
+	// running while the commands before it (such as the `go build` of `wgo
+	// run`) are restarted, and is only stopped right before the new instance
+	// starts. If any command before it fails, the old instance keeps running.
+	// Overlap takes precedence over KeepRunning.
+	KeepRunning bool
+
+	// If SkipIdentical is true, `wgo run` with KeepRunning doesn't restart the
+	// last command if the new binary is identical to the binary of the old
+	// instance (such as after a comment-only change), so that the old
+	// instance keeps its connections.
+	SkipIdentical bool
+
+	// KeepBuilds is how many of the most recent binaries built by `wgo run`
+	// are kept (as copies next to the binary) so that the commands can be
+	// rolled back to a previous build with the rollback control, without
+	// reverting the code first. The copies are removed when Run returns.
+	KeepBuilds int
+
+	// If ReadyURL is set, the last command only counts as ready once
+	// ReadyURL responds, which is reported with a "[wgo] ready" message
+	// (and as READY=1 to systemd). ReadyURL is either an http:// or https://
+	// URL (which must respond with a 2xx status code) or a TCP address like
+	// tcp://localhost:8080 (which must accept connections). If ReadyURL does
+	// not respond within ReadyTimeout (default 30 seconds), the restart is
+	// reported as failed and the -on-error hooks are run.
+	ReadyURL     string
+	ReadyTimeout time.Duration
+
+	// If HealthURL is set, it is probed every HealthInterval (default 5
+	// seconds) while the last command is running. If it fails HealthRetries
+	// times in a row (default 3), the commands are restarted. HealthURL is
+	// either an http:// or https:// URL (which must respond with a 2xx
+	// status code) or a TCP address like tcp://localhost:8080 (which must
+	// accept connections).
+	HealthURL      string
+	HealthInterval time.Duration
+	HealthRetries  int
+
+	// Open is a URL to open in the default browser once the last command is
+	// ready for the first time (and HealthURL responds, if it is set).
+	Open string
+
+	// If DesktopNotify is true, a desktop notification is shown whenever the
+	// build (or a gate) fails, and again once the commands are ready after
+	// failing. It uses osascript on macOS, notify-send on Linux and a toast
+	// notification on Windows.
+	DesktopNotify bool
+
+	// If Clear is true, the terminal (including its scrollback) is cleared
+	// before every run of the commands.
+	Clear bool
+
+	// If Bell is true, the terminal bell is rung (by writing BEL to Stderr)
+	// whenever the build (or a gate) fails.
+	Bell bool
+
+	// Webhooks is a list of URLs that are sent a JSON payload whenever the
+	// commands restart ("restart"), become ready ("success") or fail
+	// ("failure", with the error and the recent output of the commands).
+	// The payload has a "text" field, so Slack incoming webhooks can be used
+	// as they are.
+	Webhooks []string
+
+	// If Events is set, every lifecycle event (a file change, a restart, the
+	// start and finish of the build of `wgo run`, a command starting or
+	// exiting, the last command being ready, a failure) is written to it as
+	// a JSON object on its own line, for editors and other tools. It is
+	// either "fd:N" for the file descriptor N inherited from the parent,
+	// "unix:PATH" for a unix socket whose clients are all sent the events,
+	// or the path of a file that the events are appended to.
+	Events string
+
+	// If MaxMemory is not zero, the memory usage (resident set size) of the
+	// last command and its child processes is checked every 2 seconds, and
+	// the commands are restarted if it exceeds MaxMemory bytes.
+	MaxMemory uint64
+
+	// If StatsInterval is not zero, the CPU and memory usage of the last
+	// command and its child processes is logged every StatsInterval.
+	StatsInterval time.Duration
+
+	// WaitPorts are TCP addresses that must be free before the last command
+	// is started, so that a server isn't started while the old server is
+	// still holding on to its port. If an address is still in use after 10
+	// seconds, the last command is started anyway.
+	WaitPorts []string
+
+	// If Daemon is true, main() restarts wgo in the background, detached from
+	// the terminal. The PID of the background wgo is written to PIDFile
+	// (default .wgo.pid) and its output is written to DaemonLog (default
+	// .wgo.log). Run itself ignores these fields.
+	Daemon    bool
+	PIDFile   string
+	DaemonLog string
+
+	// Setup is a list of scripts that are run once, in order, before the
+	// command chain starts for the first time. They are not run again on
+	// restarts. Scripts are evaluated by the shell (sh or pwsh.exe). If a
+	// setup script fails, Run returns an error.
+	Setup []string
+
+	// WaitFor is a list of dependencies that must be reachable before the
+	// command chain starts for the first time, after the setup scripts have
+	// run. Each dependency is either an http:// or https:// URL (which must
+	// respond with a 2xx status code) or a TCP address like
+	// tcp://localhost:5432 (which must accept connections). Run waits for as
+	// long as it takes.
+	WaitFor []string
+
+	// Teardown is a list of scripts that are run once when Run returns, such
+	// as when the user hits Ctrl-C or the context is canceled. Scripts are
+	// evaluated by the shell (sh or pwsh.exe). A failing teardown script is
+	// only logged.
+	Teardown []string
+
+	// OnStart is a list of hook scripts that are run before the command chain
+	// starts, including every time it restarts. Hooks are evaluated by the
+	// shell (sh or pwsh.exe) and run outside of the command chain, so a
+	// failing hook does not stop the chain from running.
+	OnStart []string
+
+	// OnStop is a list of hook scripts that are run after a running command is
+	// stopped by wgo.
+	OnStop []string
+
+	// OnError is a list of hook scripts that are run whenever a command in the
+	// chain exits with an error.
+	OnError []string
+
+	// OnFileEvent, if set, is called with every file event that matches, i.e.
+	// that restarts the commands once the debounce duration has passed. Like
+	// the other On* callbacks (meant for programs that embed WgoCmd), it is
+	// called by the event loop of Run and so should return quickly.
+	OnFileEvent func(event fsnotify.Event)
+
+	// OnBeforeRestart, if set, is called before the command chain is started
+	// again, whether because of a file event, the control socket or a key.
+	OnBeforeRestart func()
+
+	// OnBuildFailure, if set, is called whenever the commands fail: a command
+	// in the chain exits with an error, the server doesn't become ready in
+	// time or a gate fails. The output is the recent output of the commands,
+	// such as the compiler errors. If a command in the chain failed, err is a
+	// *BuildFailedError.
+	OnBuildFailure func(err error, output string)
+
+	// OnAfterRestart, if set, is called once the commands are ready after they
+	// have been (re)started, see ReadyURL.
+	OnAfterRestart func()
+
+	// If Batches is set, Run only watches for file events and never runs the
+	// commands. Once the debounce duration has passed since the last file
+	// event that matches, the matching file events since the previous batch
+	// are sent on Batches in the order that they happened. Run closes Batches
+	// when it returns. This lets programs use WgoCmd purely as a recursive
+	// file watcher.
+	Batches chan<- []fsnotify.Event
+
+	// Gates is a list of scripts (such as `go vet ./...`) that must succeed
+	// before the commands are restarted after a file change. If a gate fails,
+	// the failure is reported and the running commands are left alone. Gates
+	// are evaluated by the shell (sh or pwsh.exe).
+	Gates []string
+
+	// If Tmux is true, main() runs every WgoCmd in its own tmux pane instead
+	// of interleaving their output in the same terminal.
+	Tmux bool
+
+	// If TUI is true, main() shows every WgoCmd in its own pane of a
+	// dashboard in the terminal, along with whether it is building, running
+	// or failed and when it last restarted.
+	TUI bool
+
+	// Name identifies the WgoCmd in the prefix of its messages, which becomes
+	// "[wgo NAME]" instead of "[wgo]". WgoCommands names each parallel WgoCmd
+	// that has no name after its command.
+	Name string
+
+	// Debounce duration for file events.
+	Debounce time.Duration
+
+	ctx      context.Context
+	isRun    bool            // Whether the command is `wgo run`.
+	binPath  string          // Where the built go binary lives.
+	keepBin  bool            // Whether binPath was chosen with -o, so it is kept.
+	controls chan control    // Controls sent to the event loop.
+	runDone  chan struct{}   // Closed when Run returns.
+	calls    chan func()     // Functions to be called by the event loop.
+	env      []string        // The environment of the commands, see environ().
+	packages *goPackages     // The packages of `wgo run`, see listPackages().
+	reloader *liveReload     // The livereload server, if LiveReload is set.
+	proxy    *devProxy       // The reverse proxy, if Proxy is set.
+	opened   bool            // Whether Open has been opened.
+	output   *outputTail     // The recent output of the commands, for the error overlay.
+	failing  bool            // Whether the commands failed since they were last ready.
+	webhook  *webhook        // Posts to Webhooks, if there are any.
+	ldflags  int             // The index of the -ldflags value in ArgsList[0], for AutoLdflags.
+	color    int             // The color of the log prefix of a parallel WgoCmd, see logPrefix().
+	tag      string          // The prefix of wgo's messages, such as "[wgo] ".
+	labels   []string        // The prefix of the output of each command in ArgsList, if Label is set.
+	started  int64           // When the commands last started in Unix nanoseconds, for Timestamps. Accessed atomically.
+	jsonLog  io.Writer       // Where wgo's messages are written to as JSON, for LogFormat json.
+	messages io.Writer       // Where wgo's messages are written to: Stderr, and the log file of LogFile.
+	pane     *tuiPane        // The pane of the -tui dashboard that shows the WgoCmd, set by main().
+	events   *eventStream    // The -events stream.
+	recorder *eventRecorder  // The -record file.
+	recFile  *recordFile     // The -record file, shared by the parallel WgoCmds that record to the same path.
+	replay   []recordedEvent // The events that `wgo replay` feeds to the WgoCmd instead of the file events, set by main().
+
+	// The following fields are only accessed by the event loop.
+	ownFiles    map[string]struct{} // The files written to by wgo itself.
+	watcher     *fsnotify.Watcher
+	paused      bool      // Whether file events are being ignored.
+	cmdsRunning bool      // Whether any command in the chain is running.
+	runs        int       // How many times the chain has been started.
+	cycleStart  time.Time // When the chain was last started, for Summary.
+	lastStart   time.Time // When the last command was last started, for Summary.
+	triggers    []string  // The files that triggered the restart, for Summary.
+	inGroup     bool      // Whether a ::group:: of the GitHub Actions log is open, for CI.
+
+	// The statistics of the session reported by the stats command of the
+	// control socket, also only accessed by the event loop.
+	sessionStart time.Time     // When Run was called.
+	builds       int           // How many times `wgo run` has built the binary.
+	buildTime    time.Duration // The total time spent building the binary.
+	readies      int           // How many times the last command has been ready.
+	readyTime    time.Duration // The total time from a (re)start of the chain to the last command being ready.
+	failures     int           // How many runs of the chain failed.
+	gateFailures int           // How many restarts were held back by the gates.
+
+	lastFailure     *buildFailure // The most recent failure, for the last-error command of the control socket.
+	lastFailureTime time.Time     // When lastFailure happened.
+
+	notifySocket string // The systemd notification socket, defaults to $NOTIFY_SOCKET.
+}
+
+// control is an instruction sent to the event loop of a running WgoCmd from
+// outside of the event loop, such as from a keypress.
+type control int
+
+const (
+	controlRestart     control = iota + 1 // Restart the commands.
+	controlTogglePause                    // Pause or resume watching for file events.
+	controlPause                          // Pause watching for file events.
+	controlResume                         // Resume watching for file events.
+	controlClear                          // Clear the screen.
+	controlQuit                           // Stop the commands and return from Run.
+	controlStop                           // Stop the commands until the next file event.
+	controlRunOnce                        // Start the commands if they are not running.
+	controlRollback                       // Restart the last command with the previous build.
+)
+
+// WgoCommands instantiates a slices of WgoCmds. Each "::" separator followed
+// by "wgo" indicates a new WgoCmd.
+func WgoCommands(ctx context.Context, args []string) ([]*WgoCmd, error) {
+	var wgoCmds []*WgoCmd
+	for i, wgoArgs := range splitWgoArgs(args) {
+		matrixCmds, err := matrixCommands(ctx, wgoArgs)
+		if err != nil {
+			return nil, fmt.Errorf("[wgo %d] %w", i+1, err)
+		}
+		wgoCmds = append(wgoCmds, matrixCmds...)
+	}
+	// Name and color the parallel WgoCmds so that their interleaved messages
+	// can be told apart.
+	if len(wgoCmds) > 1 {
+		names := make([]string, len(wgoCmds))
+		for i, wgoCmd := range wgoCmds {
+			names[i] = wgoCmd.Name
+			if names[i] == "" {
+				names[i] = wgoCmd.defaultName()
+			}
+		}
+		uniqueNames(names)
+		for i, wgoCmd := range wgoCmds {
+			wgoCmd.Name = names[i]
+			wgoCmd.color = i + 1
+		}
+		// The WgoCmds that record to the same -record file share it,
+		// instead of each truncating it.
+		recFiles := make(map[string]*recordFile)
+		for _, wgoCmd := range wgoCmds {
+			if wgoCmd.Record == "" {
+				continue
+			}
+			path, err := filepath.Abs(wgoCmd.Record)
+			if err != nil {
+				return nil, fmt.Errorf("-record: %w", err)
+			}
+			if recFiles[path] == nil {
+				recFiles[path] = &recordFile{path: wgoCmd.Record}
+			}
+			wgoCmd.recFile = recFiles[path]
+		}
+	}
+	return wgoCmds, nil
+}
+
+// splitWgoArgs splits args (os.Args) at each "::" separator followed by "wgo"
+// into the args of each WgoCmd, without the leading "wgo".
+func splitWgoArgs(args []string) [][]string {
+	var argsList [][]string
+	i, j := 1, 1
+	for j < len(args) {
+		if args[j] != "::" || j+1 >= len(args) || args[j+1] != "wgo" {
+			j++
+			continue
+		}
+		argsList = append(argsList, args[i:j])
+		i, j = j+2, j+2
+	}
+	if j > i {
+		argsList = append(argsList, args[i:j])
+	}
+	return argsList
+}
+
+// matrixCommands instantiates a WgoCmd from args, or one WgoCmd for every
+// combination of its -matrix values.
+func matrixCommands(ctx context.Context, args []string) ([]*WgoCmd, error) {
+	wgoCmd, err := WgoCommand(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(wgoCmd.Matrix) == 0 {
+		return []*WgoCmd{wgoCmd}, nil
+	}
+	if wgoCmd.ControlSocket != "" || wgoCmd.Listen != "" || wgoCmd.LiveReload != "" || wgoCmd.ProxyListen != "" || wgoCmd.Daemon {
+		return nil, fmt.Errorf("-matrix cannot be used with -socket, -listen, -livereload, -proxy or -daemon")
+	}
+	combinations := [][]string{{}}
+	for _, entry := range wgoCmd.Matrix {
+		i := strings.Index(entry, "=")
+		var next [][]string
+		for _, combination := range combinations {
+			for _, value := range strings.Split(entry[i+1:], ",") {
+				env := make([]string, len(combination), len(combination)+1)
+				copy(env, combination)
+				next = append(next, append(env, entry[:i+1]+value))
+			}
+		}
+		combinations = next
+	}
+	wgoCmds := make([]*WgoCmd, 0, len(combinations))
+	for _, combination := range combinations {
+		// Instantiate each WgoCmd from scratch so that they don't share any
+		// state (such as the path of the built binary).
+		wgoCmd, err := WgoCommand(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		wgoCmd.Matrix = nil
+		wgoCmd.Env = append(wgoCmd.Env, combination...)
+		wgoCmd.Name = strings.TrimSpace(wgoCmd.Name + " " + strings.Join(combination, " "))
+		wgoCmds = append(wgoCmds, wgoCmd)
+	}
+	return wgoCmds, nil
+}
+
+// defaultName returns the name of the WgoCmd after its command: the package
+// (or first .go file) of `wgo run`, or the program run by the first command.
+func (wgoCmd *WgoCmd) defaultName() string {
+	if len(wgoCmd.ArgsList) == 0 || len(wgoCmd.ArgsList[0]) == 0 {
+		return ""
+	}
+	args := wgoCmd.ArgsList[0]
+	if !wgoCmd.isRun {
+		return strings.TrimSuffix(filepath.Base(args[0]), ".exe")
+	}
+	pkg := args[len(args)-1]
+	for i := len(args) - 2; i >= 0 && strings.HasSuffix(args[i], ".go") && strings.HasSuffix(pkg, ".go"); i-- {
+		pkg = args[i]
+	}
+	if strings.HasSuffix(pkg, ".go") {
+		return strings.TrimSuffix(filepath.Base(pkg), ".go")
+	}
+	dir, err := filepath.Abs(filepath.Join(wgoCmd.dir(0), pkg))
+	if err != nil {
+		return filepath.Base(pkg)
+	}
+	return filepath.Base(dir)
+}
+
+// label returns the label of the i-th command for Label: "build" and the name
+// of the package for the build and the binary of `wgo run`, or the name of the
+// program that the command runs.
+func (wgoCmd *WgoCmd) label(i int) string {
+	if wgoCmd.isRun && i == 0 {
+		return "build"
+	}
+	if wgoCmd.isRun && i == 1 {
+		return wgoCmd.defaultName()
+	}
+	if len(wgoCmd.ArgsList[i]) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(filepath.Base(wgoCmd.ArgsList[i][0]), ".exe")
+}
+
+// message writes one of wgo's messages to Stderr (and the LogFile), after the
+// prefix of the WgoCmd (and the timestamp, if Timestamps is set) or as JSON.
+func (wgoCmd *WgoCmd) message(msg string) {
+	if wgoCmd.jsonLog != nil {
+		_, _ = io.WriteString(wgoCmd.jsonLog, msg)
+		return
+	}
+	if wgoCmd.Timestamps {
+		msg = wgoCmd.timestamp() + wgoCmd.tag + msg
+	} else {
+		msg = wgoCmd.tag + msg
+	}
+	w := wgoCmd.messages
+	if w == nil {
+		w = wgoCmd.Stderr
+	}
+	fmt.Fprintln(w, msg)
+}
+
+// timestamp returns the current time and the time elapsed since the commands
+// last started, for Timestamps and TimestampOutput.
+func (wgoCmd *WgoCmd) timestamp() string {
+	now := time.Now()
+	elapsed := now.Sub(time.Unix(0, atomic.LoadInt64(&wgoCmd.started)))
+	return now.Format("15:04:05.000") + " +" + strconv.FormatFloat(elapsed.Seconds(), 'f', 3, 64) + "s "
+}
+
+// outputWriter wraps w, the stdout or stderr of the i-th command, so that
+// every line starts with the label and/or the timestamp of the command. With
+// FailureFormat vscode, the locations of errors are made absolute as well.
+func (wgoCmd *WgoCmd) outputWriter(w io.Writer, i int) io.Writer {
+	if wgoCmd.Label || wgoCmd.TimestampOutput {
+		pw := newPrefixWriter(w, "")
+		if wgoCmd.Label {
+			pw.prefix = []byte(wgoCmd.labels[i])
+		}
+		if wgoCmd.TimestampOutput {
+			pw.stamp = wgoCmd.timestamp
+		}
+		w = pw
+	}
+	if wgoCmd.FailureFormat == "vscode" {
+		w = &problemWriter{w: w, dir: wgoCmd.dir(i)}
+	}
+	return w
+}
+
+// WgoCommand instantiates a new WgoCmd. The args are those of a single wgo
+// command without the leading "wgo" e.g. []string{"run", "-file", ".html",
+// "main.go"}. Each "::" separator indicates a new chained command. The WgoCmd
+// stops once the context is canceled.
+func WgoCommand(ctx context.Context, args []string) (*WgoCmd, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	wgoCmd := WgoCmd{
+		Roots:  []string{cwd},
+		Logger: defaultLogger,
+		ctx:    ctx,
+	}
+	var verbose bool
+	// `wgo debug` is `wgo run` under the Delve debugger.
+	isDebug := len(args) > 0 && args[0] == "debug"
+	wgoCmd.isRun = len(args) > 0 && (args[0] == "run" || isDebug)
+	if wgoCmd.isRun {
+		args = args[1:]
+	}
+
+	// Parse flags.
+	var debounce string
+	flagset := flag.NewFlagSet("", flag.ContinueOnError)
+	flagset.StringVar(&wgoCmd.Dir, "cd", "", "Change to a different directory to run the commands.")
+	flagset.BoolVar(&verbose, "verbose", false, "Log file events.")
+	flagset.BoolVar(&wgoCmd.Explain, "explain", false, "Like -verbose, but also say which -file, -xfile, -dir or -xdir regex made a file event match or get skipped.")
+	flagset.BoolVar(&wgoCmd.Trace, "vv", false, "Like -verbose, but also trace every raw file event, matcher decision and debounce timer reset.")
+	flagset.BoolVar(&wgoCmd.Exit, "exit", false, "Exit when the last command exits.")
+	flagset.BoolVar(&wgoCmd.CI, "ci", false, "Run the commands once for CI: implies -exit, exits if any command fails, groups the output of each command and annotates build failures for GitHub Actions.")
+	flagset.BoolVar(&wgoCmd.Generate, "generate", false, "Run go generate in the changed packages that have //go:generate directives before restarting.")
+	flagset.BoolVar(&wgoCmd.AutoLdflags, "auto-ldflags", false, "Set main.commit, main.branch, main.dirty and main.buildTime with -ldflags -X on every rebuild (wgo run only).")
+	flagset.StringVar(&wgoCmd.SSH, "ssh", "", "Copy the binary to this host with scp and run it there with ssh e.g. pi@raspberrypi (wgo run only).")
+	flagset.StringVar(&wgoCmd.SSHPath, "ssh-path", "", "The path to copy the binary to on the -ssh host (default /tmp/wgo_<package directory name>).")
+	flagset.StringVar(&wgoCmd.Sync, "sync", "", "Copy the changed files to this rsync destination before restarting e.g. devbox:/srv/app.")
+	flagset.StringVar(&wgoCmd.Go, "go", "", "The go command to use for building and go generate e.g. gotip or /usr/local/go1.23rc1/bin/go (default go in PATH).")
+	flagset.BoolVar(&wgoCmd.Deps, "deps", false, "Only watch and restart for the packages imported by the main package (wgo run only).")
+	flagset.BoolVar(&wgoCmd.Daemon, "daemon", false, "Run wgo in the background. Use `wgo stop` to stop it.")
+	flagset.StringVar(&wgoCmd.PIDFile, "pid-file", "", "Where -daemon writes the PID of wgo (default "+defaultPIDFile+").")
+	flagset.StringVar(&wgoCmd.DaemonLog, "daemon-log", "", "Where -daemon writes the output of wgo (default "+defaultDaemonLog+").")
+	flagset.BoolVar(&wgoCmd.EnableStdin, "stdin", false, "Enable stdin for the last command.")
+	flagset.BoolVar(&wgoCmd.BroadcastStdin, "stdin-all", false, "Enable stdin for every command.")
+	flagset.BoolVar(&wgoCmd.StdinFiles, "stdin-files", false, "Read the list of files to watch from stdin.")
+	flagset.StringVar(&wgoCmd.Record, "record", "", "Record every file event to a file, for wgo replay.")
+	flagset.BoolVar(&wgoCmd.EnableKeys, "keys", false, "Enable keyboard controls: r (restart), p (pause/resume), c (clear), q (quit).")
+	flagset.Func("bind", "Listen on a TCP address and pass the socket to the last command (LISTEN_FDS). Can be repeated.", func(value string) error {
+		wgoCmd.Bind = append(wgoCmd.Bind, value)
+		return nil
+	})
+	flagset.StringVar(&wgoCmd.ControlSocket, "socket", "", "Listen for control commands on a unix socket e.g. .wgo.sock.")
+	flagset.StringVar(&wgoCmd.LiveReload, "livereload", "", "Reload the browsers that loaded /livereload.js from this address when the commands restart e.g. :35729.")
+	flagset.BoolVar(&wgoCmd.TLS, "tls", false, "Serve the -proxy and -livereload servers over HTTPS.")
+	flagset.StringVar(&wgoCmd.TLSCert, "tls-cert", "", "The certificate file for -tls. Defaults to a self-signed certificate for localhost.")
+	flagset.StringVar(&wgoCmd.TLSKey, "tls-key", "", "The private key file for -tls-cert.")
+	flagset.StringVar(&wgoCmd.Proxy, "proxy", "", "Proxy requests from -proxy-listen to this server and hold them while it restarts e.g. localhost:8080.")
+	flagset.StringVar(&wgoCmd.ProxyListen, "proxy-listen", "", "The address that the -proxy listens on e.g. :3000.")
+	flagset.StringVar(&wgoCmd.Listen, "listen", "", "Listen for POST /restart, /stop and /run-once requests on an HTTP address e.g. localhost:9000.")
+	flagset.BoolVar(&wgoCmd.PTY, "pty", false, "Run the last command in a pseudo-terminal.")
+	flagset.BoolVar(&wgoCmd.MergeOutput, "merge-output", false, "Merge the commands' stderr into stdout.")
+	flagset.BoolVar(&wgoCmd.Label, "label", false, "Prefix every line of the commands' output with the label of the command.")
+	flagset.BoolVar(&wgoCmd.Timestamps, "timestamps", false, "Prefix wgo's messages with the time and the time elapsed since the commands started.")
+	flagset.Func("log-format", "The format of wgo's messages and logs: text or json. json turns on -verbose.", func(value string) error {
+		if value != "text" && value != "json" {
+			return fmt.Errorf("%q is not text or json", value)
+		}
+		wgoCmd.LogFormat = value
+		return nil
+	})
+	flagset.Func("failure-format", "The format of build failures: text, vscode or github. vscode works with the $go problem matcher of VS Code tasks and github annotates the errors in GitHub Actions.", func(value string) error {
+		if value != "text" && value != "vscode" && value != "github" {
+			return fmt.Errorf("%q is not text, vscode or github", value)
+		}
+		wgoCmd.FailureFormat = value
+		return nil
+	})
+	flagset.StringVar(&wgoCmd.LogFile, "log-file", "", "Also write wgo's messages and logs to this file, rotating it when it grows too big.")
+	flagset.Func("log-file-size", "The size at which the -log-file is rotated e.g. 50MB. Default 10MB.", func(value string) error {
+		var err error
+		wgoCmd.LogFileSize, err = parseSize(value)
+		if err == nil && wgoCmd.LogFileSize == 0 {
+			err = fmt.Errorf("%q is not a positive size", value)
+		}
+		return err
+	})
+	flagset.BoolVar(&wgoCmd.LogFileOutput, "log-file-output", false, "Write the output of the commands to the -log-file as well.")
+	flagset.BoolVar(&wgoCmd.Summary, "summary", false, "Print how long each restart took and which files triggered it.")
+	flagset.BoolVar(&wgoCmd.Quiet, "quiet", false, "Only print the output of the commands, not wgo's own messages and logs.")
+	flagset.BoolVar(&wgoCmd.TimestampOutput, "timestamp-output", false, "Prefix every line of the commands' output with the time and the time elapsed since the commands started.")
+	flagset.StringVar(&wgoCmd.OutputFilter, "output-filter", "", "Pipe the commands' stdout and stderr through a shell command.")
+	flagset.Func("kill-timeout", "Kill commands that are still running this long after being asked to stop e.g. 10s.", func(value string) error {
+		var err error
+		wgoCmd.KillTimeout, err = time.ParseDuration(value)
+		return err
+	})
+	flagset.StringVar(&wgoCmd.DumpFile, "dump-on-hang", "", "Send SIGQUIT to the last command before killing it and save its goroutine dump to this file.")
+	flagset.Func("env", "Set an environment variable for the commands e.g. PORT=8080. Can be repeated.", func(value string) error {
+		if !strings.Contains(value, "=") || strings.HasPrefix(value, "=") {
+			return fmt.Errorf("invalid environment variable %q, expected KEY=VALUE", value)
+		}
+		wgoCmd.Env = append(wgoCmd.Env, value)
+		return nil
+	})
+	flagset.Func("matrix", "Run a copy of the commands for each value of an environment variable e.g. REGION=us,eu. Can be repeated.", func(value string) error {
+		i := strings.Index(value, "=")
+		if i <= 0 || i == len(value)-1 {
+			return fmt.Errorf("invalid matrix %q, expected KEY=VALUE1,VALUE2", value)
+		}
+		wgoCmd.Matrix = append(wgoCmd.Matrix, value)
+		return nil
+	})
+	flagset.Func("env-file", "Load environment variables for the commands from a dotenv file, which is read again on every restart. Can be repeated.", func(value string) error {
+		wgoCmd.EnvFiles = append(wgoCmd.EnvFiles, value)
+		return nil
+	})
+	flagset.Func("env-cmd", "Set environment variables for the commands from the output (KEY=VALUE lines or JSON) of a shell command, which is run on every restart. Can be repeated.", func(value string) error {
+		wgoCmd.EnvCmds = append(wgoCmd.EnvCmds, value)
+		return nil
+	})
+	flagset.BoolVar(&wgoCmd.Expand, "expand", false, "Expand $VAR and ${VAR} in the commands' arguments every time they are started.")
+	flagset.Func("mask", "Regex matching the names of environment variables and flags whose values are hidden in the logs. Can be repeated. Default TOKEN|PASSWORD|SECRET|KEY.", func(value string) error {
+		r, err := regexp.Compile("(?i)" + value)
+		if err != nil {
+			return err
+		}
+		wgoCmd.MaskRegexps = append(wgoCmd.MaskRegexps, r)
+		return nil
+	})
+	flagset.BoolVar(&wgoCmd.CleanEnv, "clean-env", false, "Only pass PATH, HOME and a few other essential environment variables (plus any -pass variables) to the commands.")
+	flagset.Func("pass", "Comma-separated environment variables to pass to the commands with -clean-env. Can be repeated.", func(value string) error {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				wgoCmd.PassEnv = append(wgoCmd.PassEnv, name)
+			}
+		}
+		return nil
+	})
+	flagset.Func("rlimit", "Apply a resource limit to the last command e.g. nofile=1024 or as=2GB. Can be repeated.", func(value string) error {
+		_, _, err := parseRlimit(value)
+		if err != nil {
+			return err
+		}
+		wgoCmd.Rlimits = append(wgoCmd.Rlimits, value)
+		return nil
+	})
+	flagset.Func("nice", "Run the commands at a lower (1 to 19) or higher (-1 to -20) scheduling priority.", func(value string) error {
+		var err error
+		wgoCmd.Nice, err = strconv.Atoi(value)
+		if err == nil && (wgoCmd.Nice < -20 || wgoCmd.Nice > 19) {
+			err = fmt.Errorf("%d is not between -20 and 19", wgoCmd.Nice)
+		}
+		return err
+	})
+	flagset.BoolVar(&wgoCmd.ForwardSignals, "forward-signals", false, "Forward SIGHUP, SIGUSR1 and SIGUSR2 to the commands instead of pausing and resuming on SIGUSR1 and SIGUSR2.")
+	flagset.BoolVar(&wgoCmd.Overlap, "overlap", false, "Only stop the old instance of the last command once the new instance is ready.")
+	flagset.BoolVar(&wgoCmd.KeepRunning, "keep-running", false, "Keep the old instance of the last command running until the commands before it succeed.")
+	flagset.BoolVar(&wgoCmd.SkipIdentical, "skip-identical", false, "Don't restart if the new binary is identical to the running one, implies -keep-running (wgo run only).")
+	flagset.IntVar(&wgoCmd.KeepBuilds, "keep-builds", 0, "Keep the last N binaries so that `wgo ctl rollback` can restart the previous build (wgo run only).")
+	flagset.StringVar(&wgoCmd.OverlapProbe, "overlap-probe", "", "URL or tcp:// address that responds once the new instance is ready (requires -overlap).")
+	flagset.Func("overlap-timeout", "How long to wait for the new instance to be ready (requires -overlap). Default 30s.", func(value string) error {
+		var err error
+		wgoCmd.OverlapTimeout, err = time.ParseDuration(value)
+		return err
+	})
+	flagset.StringVar(&wgoCmd.ReadyURL, "ready-url", "", "URL or tcp:// address that responds once the last command is ready.")
+	flagset.Func("ready-timeout", "How long to wait for -ready-url to respond. Default 30s.", func(value string) error {
+		var err error
+		wgoCmd.ReadyTimeout, err = time.ParseDuration(value)
+		return err
+	})
+	flagset.StringVar(&wgoCmd.Events, "events", "", "Write every lifecycle event as a JSON line to fd:N, unix:PATH (a socket) or a file.")
+	flagset.Func("webhook", "URL to post a JSON payload to when the commands restart, succeed or fail. Can be repeated.", func(value string) error {
+		wgoCmd.Webhooks = append(wgoCmd.Webhooks, value)
+		return nil
+	})
+	flagset.BoolVar(&wgoCmd.Clear, "clear", false, "Clear the terminal before every run of the commands.")
+	flagset.BoolVar(&wgoCmd.Bell, "bell", false, "Ring the terminal bell when the build fails.")
+	flagset.BoolVar(&wgoCmd.DesktopNotify, "notify", false, "Show a desktop notification when the build fails and when it is fixed.")
+	flagset.StringVar(&wgoCmd.Open, "open", "", "URL to open in the browser once the last command is ready for the first time.")
+	flagset.StringVar(&wgoCmd.HealthURL, "health", "", "URL or tcp:// address to probe periodically while the last command runs. The commands are restarted if it keeps failing.")
+	flagset.Func("health-interval", "How often to probe -health. Default 5s.", func(value string) error {
+		var err error
+		wgoCmd.HealthInterval, err = time.ParseDuration(value)
+		return err
+	})
+	flagset.IntVar(&wgoCmd.HealthRetries, "health-retries", 0, "How many times in a row -health may fail before the commands are restarted. Default 3.")
+	flagset.Func("max-mem", "Restart the commands if the last command uses more memory than this e.g. 500MB.", func(value string) error {
+		var err error
+		wgoCmd.MaxMemory, err = parseSize(value)
+		return err
+	})
+	flagset.Func("stats", "Log the CPU and memory usage of the last command at this interval e.g. 10s.", func(value string) error {
+		var err error
+		wgoCmd.StatsInterval, err = time.ParseDuration(value)
+		if err == nil && wgoCmd.StatsInterval <= 0 {
+			err = fmt.Errorf("interval must be positive")
+		}
+		return err
+	})
+	flagset.Func("wait-port", "Wait until a TCP address e.g. localhost:8080 is free before starting the last command. Can be repeated.", func(value string) error {
+		wgoCmd.WaitPorts = append(wgoCmd.WaitPorts, value)
+		return nil
+	})
+	flagset.StringVar(&debounce, "debounce", "300ms", "How quickly to react to file events. Lower debounce values will react quicker.")
+	flagset.Func("setup", "Run a shell command once before the commands start for the first time. Can be repeated.", func(value string) error {
+		wgoCmd.Setup = append(wgoCmd.Setup, value)
+		return nil
+	})
+	flagset.Func("wait-for", "Wait until a URL or tcp:// address responds before the commands start for the first time. Can be repeated.", func(value string) error {
+		wgoCmd.WaitFor = append(wgoCmd.WaitFor, value)
+		return nil
+	})
+	flagset.Func("teardown", "Run a shell command once when wgo exits. Can be repeated.", func(value string) error {
+		wgoCmd.Teardown = append(wgoCmd.Teardown, value)
+		return nil
+	})
+	flagset.Func("on-start", "Run a shell command before the commands start or restart. Can be repeated.", func(value string) error {
+		wgoCmd.OnStart = append(wgoCmd.OnStart, value)
+		return nil
+	})
+	flagset.Func("on-stop", "Run a shell command after a running command is stopped. Can be repeated.", func(value string) error {
+		wgoCmd.OnStop = append(wgoCmd.OnStop, value)
+		return nil
+	})
+	flagset.Func("compose-restart", "Run docker compose restart for this service after the commands succeed. Can be repeated.", func(value string) error {
+		wgoCmd.ComposeRestart = append(wgoCmd.ComposeRestart, value)
+		return nil
+	})
+	flagset.Func("compose-up", "Run docker compose up --build -d for this service after the commands succeed. Can be repeated.", func(value string) error {
+		wgoCmd.ComposeUp = append(wgoCmd.ComposeUp, value)
+		return nil
+	})
+	flagset.Func("kube-rollout", "Run kubectl rollout restart for this resource after the commands succeed e.g. deployment/api. Can be repeated.", func(value string) error {
+		wgoCmd.KubeRollout = append(wgoCmd.KubeRollout, value)
+		return nil
+	})
+	flagset.BoolVar(&wgoCmd.Tmux, "tmux", false, "Run each parallel wgo command in its own tmux pane.")
+	flagset.BoolVar(&wgoCmd.TUI, "tui", false, "Show each parallel wgo command in its own pane of a dashboard with its status and scrollable output.")
+	flagset.StringVar(&wgoCmd.Name, "name", "", "The name of the wgo command in the prefix of its messages. Defaults to the name of the command for parallel wgo commands.")
+	flagset.Func("gate", "Run a shell command before restarting, and don't restart if it fails. Can be repeated.", func(value string) error {
+		wgoCmd.Gates = append(wgoCmd.Gates, value)
+		return nil
+	})
+	flagset.Func("on-error", "Run a shell command whenever a command fails. Can be repeated.", func(value string) error {
+		wgoCmd.OnError = append(wgoCmd.OnError, value)
+		return nil
+	})
+	flagset.Func("root", "Specify an additional root directory to watch. Can be repeated.", func(value string) error {
+		root, err := filepath.Abs(value)
+		if err != nil {
+			return err
+		}
+		wgoCmd.Roots = append(wgoCmd.Roots, root)
+		return nil
+	})
+	wgoCmd.addMatchFlags(flagset)
+	flagset.StringVar(&wgoCmd.Filter, "filter", "", "A shell command that decides whether a file event restarts the commands. It reads the event as JSON from stdin and exits with 0 to restart or 1 to skip.")
+	flagset.Usage = func() {
+		fmt.Fprint(flagset.Output(), `Usage:
+  wgo [FLAGS] <command> [ARGUMENTS...]
+  wgo gcc -o main main.c
+  wgo go build -o main main.go
+  wgo -file .c gcc -o main main.c
+  wgo -file=.go go build -o main main.go
+Flags:
+`)
+		flagset.PrintDefaults()
+	}
+	// If the command is `wgo run`, also parse the go build flags.
+	var strFlagValues []string
+	var boolFlagValues []bool
+	var buildFlags []string
+	var buildDirFlag string
+	var output, tmpDir, dockerTarget, kubeTarget string
+	if wgoCmd.isRun {
+		flagset.Func("kube", "Copy the binary into a pod and run it there e.g. -kube mypod:/tmp/server or -kube dev/mypod:/tmp/server.", func(value string) error {
+			i := strings.Index(value, ":")
+			if i <= 0 || !strings.HasPrefix(value[i+1:], "/") {
+				return fmt.Errorf("%q is not [NAMESPACE/]POD:/PATH", value)
+			}
+			kubeTarget = value
+			return nil
+		})
+		flagset.Func("docker", "Copy the binary into a container and restart the container e.g. -docker myapp:/app/server.", func(value string) error {
+			i := strings.Index(value, ":")
+			if i <= 0 || !strings.HasPrefix(value[i+1:], "/") {
+				return fmt.Errorf("%q is not CONTAINER:/PATH", value)
+			}
+			dockerTarget = value
+			return nil
+		})
+		flagset.StringVar(&output, "o", "", "Build the binary to this path and keep it, instead of a temporary file that is removed when wgo exits.")
+		flagset.StringVar(&tmpDir, "tmpdir", "", "The directory to build the temporary binary in (default $GOTMPDIR or the system temp directory).")
+		flagset.Func("buildflag", "Pass a flag to go build as-is e.g. -buildflag=-cover or -buildflag=-pgo=auto. Can be repeated.", func(value string) error {
+			if !strings.HasPrefix(value, "-") {
+				return fmt.Errorf("%q is not a flag", value)
+			}
+			// go build only accepts -C as the first flag, so it is kept
+			// aside and put first.
+			name := strings.TrimLeft(value, "-")
+			if name == "C" {
+				return fmt.Errorf("%s needs a value, use -buildflag=%s=DIR", value, value)
+			}
+			if strings.HasPrefix(name, "C=") {
+				buildDirFlag = value
+				return nil
+			}
+			// -ldflags is kept with the other -ldflags values, so that
+			// -auto-ldflags adds its -X flags to it instead of being
+			// overridden by it.
+			if strings.HasPrefix(name, "ldflags=") {
+				strFlagValues = append(strFlagValues, "-ldflags", strings.TrimPrefix(name, "ldflags="))
+				return nil
+			}
+			buildFlags = append(buildFlags, value)
+			return nil
+		})
+		strFlagValues = make([]string, 0, len(strFlagNames))
+		for i := range strFlagNames {
+			name := strFlagNames[i]
+			flagset.Func(name, "-"+name+" build flag for Go.", func(value string) error {
+				strFlagValues = append(strFlagValues, "-"+name, value)
+				return nil
+			})
+		}
+		boolFlagValues = make([]bool, len(boolFlagNames))
+		for i := range boolFlagNames {
+			name := boolFlagNames[i]
+			flagset.BoolVar(&boolFlagValues[i], name, false, "-"+name+" build flag for Go.")
+		}
+		flagset.Usage = func() {
+			fmt.Fprint(flagset.Output(), `Usage:
+  wgo run [FLAGS] [GO_BUILD_FLAGS] <package> [ARGUMENTS...]
+  wgo run main.go
+  wgo run -file .html main.go arg1 arg2 arg3
+  wgo run -file .html . arg1 arg2 arg3
+  wgo run -file=.css -file=.js -tags=fts5 ./cmd/my_project arg1 arg2 arg3
+  wgo debug [FLAGS] [GO_BUILD_FLAGS] <package> [ARGUMENTS...]
+  wgo debug -dlv-listen :2345 main.go arg1 arg2 arg3
+Flags:
+`)
+			flagset.PrintDefaults()
+		}
+	}
+	dlvListen := "127.0.0.1:2345"
+	if isDebug {
+		flagset.StringVar(&dlvListen, "dlv-listen", dlvListen, "The address that the Delve debugger listens on (wgo debug only).")
+	}
+	err = flagset.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if wgoCmd.CI {
+		wgoCmd.Exit = true
+		if wgoCmd.FailureFormat == "" {
+			wgoCmd.FailureFormat = "github"
+		}
+	}
+	if verbose || wgoCmd.Explain || wgoCmd.Trace || wgoCmd.LogFormat == "json" {
+		wgoCmd.Logger = log.New(os.Stderr, "[wgo] ", 0)
+	}
+	// A relative path to the go command must not depend on the directory
+	// that the command is run in.
+	if wgoCmd.Go != "" && filepath.Base(wgoCmd.Go) != wgoCmd.Go {
+		wgoCmd.Go, err = filepath.Abs(wgoCmd.Go)
+		if err != nil {
+			return nil, fmt.Errorf("-go: %w", err)
+		}
+	}
+	if wgoCmd.Deps && !wgoCmd.isRun {
+		return nil, fmt.Errorf("-deps can only be used with wgo run")
+	}
+	if wgoCmd.KeepBuilds < 0 {
+		return nil, fmt.Errorf("-keep-builds: %d is negative", wgoCmd.KeepBuilds)
+	}
+	if wgoCmd.KeepBuilds > 0 && !wgoCmd.isRun {
+		return nil, fmt.Errorf("-keep-builds can only be used with wgo run")
+	}
+	if wgoCmd.SSH != "" {
+		if !wgoCmd.isRun || isDebug {
+			return nil, fmt.Errorf("-ssh can only be used with wgo run")
+		}
+		if dockerTarget != "" {
+			return nil, fmt.Errorf("-ssh cannot be used together with -docker")
+		}
+		if len(wgoCmd.Bind) > 0 {
+			return nil, fmt.Errorf("-ssh cannot be used together with -bind")
+		}
+	}
+	if kubeTarget != "" && (wgoCmd.SSH != "" || dockerTarget != "") {
+		return nil, fmt.Errorf("-kube cannot be used together with -ssh or -docker")
+	}
+	if kubeTarget != "" && (isDebug || len(wgoCmd.Bind) > 0) {
+		return nil, fmt.Errorf("-kube cannot be used with wgo debug or -bind")
+	}
+	if dockerTarget != "" {
+		if isDebug {
+			return nil, fmt.Errorf("-docker cannot be used with wgo debug")
+		}
+		if len(wgoCmd.Bind) > 0 {
+			return nil, fmt.Errorf("-docker cannot be used together with -bind")
+		}
+	}
+	if (wgoCmd.Proxy == "") != (wgoCmd.ProxyListen == "") {
+		return nil, fmt.Errorf("-proxy and -proxy-listen must be used together")
+	}
+	if (wgoCmd.TLSCert == "") != (wgoCmd.TLSKey == "") {
+		return nil, fmt.Errorf("-tls-cert and -tls-key must be used together")
+	}
+	if wgoCmd.TLSCert != "" {
+		wgoCmd.TLS = true
+	}
+	if wgoCmd.TLS && wgoCmd.Proxy == "" && wgoCmd.LiveReload == "" {
+		return nil, fmt.Errorf("-tls can only be used with -proxy or -livereload")
+	}
+	if wgoCmd.Tmux && wgoCmd.Daemon {
+		return nil, fmt.Errorf("-tmux cannot be used together with -daemon")
+	}
+	if wgoCmd.TUI && (wgoCmd.Tmux || wgoCmd.Daemon) {
+		return nil, fmt.Errorf("-tui cannot be used together with -tmux or -daemon")
+	}
+	if wgoCmd.TUI && (wgoCmd.EnableStdin || wgoCmd.BroadcastStdin || wgoCmd.EnableKeys) {
+		return nil, fmt.Errorf("-tui reads the keys from stdin, it cannot be used together with -stdin, -stdin-all or -keys")
+	}
+	if wgoCmd.AutoLdflags && !wgoCmd.isRun {
+		return nil, fmt.Errorf("-auto-ldflags can only be used with wgo run")
+	}
+	if wgoCmd.SkipIdentical {
+		if !wgoCmd.isRun {
+			return nil, fmt.Errorf("-skip-identical can only be used with wgo run")
+		}
+		wgoCmd.KeepRunning = true
+	}
+	if wgoCmd.StdinFiles && (wgoCmd.EnableStdin || wgoCmd.BroadcastStdin) {
+		return nil, fmt.Errorf("-stdin-files cannot be used together with -stdin or -stdin-all")
+	}
+	if debounce == "" {
+		wgoCmd.Debounce = 300 * time.Millisecond
+	} else {
+		wgoCmd.Debounce, err = time.ParseDuration(debounce)
+		if err != nil {
+			return nil, fmt.Errorf("-debounce: %w", err)
+		}
+	}
+
+	// If the command is `wgo run`, prepend a `go build` command to the
+	// ArgsList.
+	flagArgs := flagset.Args()
+	wgoCmd.ArgsList = append(wgoCmd.ArgsList, []string{})
+	if wgoCmd.isRun {
+		if len(flagArgs) == 0 {
+			if isDebug {
+				return nil, fmt.Errorf("wgo debug: package not provided")
+			}
+			return nil, fmt.Errorf("wgo run: package not provided")
+		}
+		if output != "" {
+			wgoCmd.binPath, err = filepath.Abs(output)
+			if err != nil {
+				return nil, fmt.Errorf("-o: %w", err)
+			}
+			if runtime.GOOS == "windows" && filepath.Ext(wgoCmd.binPath) == "" {
+				wgoCmd.binPath += ".exe"
+			}
+			wgoCmd.keepBin = true
+		} else {
+			// Determine the temp directory to put the binary in.
+			// https://github.com/golang/go/issues/8451#issuecomment-341475329
+			if tmpDir == "" {
+				tmpDir = os.Getenv("GOTMPDIR")
+			}
+			if tmpDir == "" {
+				tmpDir = os.TempDir()
+			}
+			tmpDir, err = filepath.Abs(tmpDir)
+			if err != nil {
+				return nil, fmt.Errorf("-tmpdir: %w", err)
+			}
+			// The binary name contains wgo's PID so that binaries left behind
+			// by a wgo that crashed can be told apart from the binaries of a
+			// wgo that is still running (see removeStaleBinaries).
+			wgoCmd.binPath = filepath.Join(tmpDir, "wgo_"+time.Now().Format("20060102150405")+"_"+strconv.Itoa(os.Getpid())+"_"+strconv.Itoa(rand.Intn(5000)))
+			if runtime.GOOS == "windows" {
+				wgoCmd.binPath += ".exe"
+			}
+		}
+		buildArgs := []string{wgoCmd.goCommand(), "build"}
+		if buildDirFlag != "" {
+			buildArgs = append(buildArgs, buildDirFlag)
+		}
+		buildArgs = append(buildArgs, "-o", wgoCmd.binPath)
+		if isDebug {
+			// Disable optimizations and inlining so that the debugger can
+			// show every variable. A -gcflags passed by the user comes later
+			// and overrides this.
+			buildArgs = append(buildArgs, "-gcflags", "all=-N -l")
+		}
+		offset := len(buildArgs)
+		buildArgs = append(buildArgs, strFlagValues...)
+		if wgoCmd.AutoLdflags {
+			// Remember where the last -ldflags value is, so that the -X
+			// flags can be added to it before every build.
+			for n := 0; n < len(strFlagValues); n += 2 {
+				if strFlagValues[n] == "-ldflags" {
+					wgoCmd.ldflags = offset + n + 1
+				}
+			}
+			if wgoCmd.ldflags == 0 {
+				buildArgs = append(buildArgs, "-ldflags", "")
+				wgoCmd.ldflags = len(buildArgs) - 1
+			}
+		}
+		for i, ok := range boolFlagValues {
+			if ok {
+				buildArgs = append(buildArgs, "-"+boolFlagNames[i])
+			}
+		}
+		buildArgs = append(buildArgs, buildFlags...)
+		// Like `go run`, if the package argument is a .go file then every
+		// .go file that follows it is part of the package as well.
+		numFiles := 1
+		if strings.HasSuffix(flagArgs[0], ".go") {
+			for numFiles < len(flagArgs) && strings.HasSuffix(flagArgs[numFiles], ".go") {
+				numFiles++
+			}
+		}
+		buildArgs = append(buildArgs, flagArgs[:numFiles]...)
+		runArgs := []string{wgoCmd.binPath}
+		if isDebug {
+			// --accept-multiclient lets the editor disconnect and reattach
+			// without stopping the program, and --continue starts the
+			// program without waiting for the editor.
+			runArgs = []string{
+				"dlv", "exec", wgoCmd.binPath, "--headless", "--accept-multiclient", "--continue",
+				"--listen", dlvListen, "--api-version", "2", "--",
+			}
+		}
+		wgoCmd.ArgsList = [][]string{buildArgs, runArgs}
+		flagArgs = flagArgs[numFiles:]
+	}
+
+	segmentStart := false
+	for j := 0; j < len(flagArgs); j++ {
+		arg := flagArgs[j]
+		n := len(wgoCmd.ArgsList) - 1
+
+		// Chained commands may begin with their own -cd and -wait flags e.g.
+		// `:: -cd web sass styles.scss styles.css` or `:&: -wait
+		// tcp://localhost:8080 go run ./seed`.
+		if segmentStart {
+			if arg == "-wait" || arg == "--wait" {
+				if j+1 >= len(flagArgs) {
+					return nil, fmt.Errorf("flag needs an argument: %s", arg)
+				}
+				j++
+				wgoCmd.setWait(n, flagArgs[j])
+				continue
+			}
+			if strings.HasPrefix(arg, "-wait=") || strings.HasPrefix(arg, "--wait=") {
+				wgoCmd.setWait(n, arg[strings.Index(arg, "=")+1:])
+				continue
+			}
+			if arg == "-cd" || arg == "--cd" {
+				if j+1 >= len(flagArgs) {
+					return nil, fmt.Errorf("flag needs an argument: %s", arg)
+				}
+				j++
+				wgoCmd.setDir(n, flagArgs[j])
+				continue
+			}
+			if strings.HasPrefix(arg, "-cd=") || strings.HasPrefix(arg, "--cd=") {
+				wgoCmd.setDir(n, arg[strings.Index(arg, "=")+1:])
+				continue
+			}
+		}
+		segmentStart = false
+
+		// If arg is a separator, start a new command.
+		if isSeparator(arg) {
+			if arg != "::" {
+				for len(wgoCmd.Separators) <= n {
+					wgoCmd.Separators = append(wgoCmd.Separators, "")
+				}
+				wgoCmd.Separators[n] = arg
+			}
+			wgoCmd.ArgsList = append(wgoCmd.ArgsList, []string{})
+			segmentStart = true
+			continue
+		}
+
+		// Unescape ":::" => "::", "::::" => ":::", "::;:" => ":;:" etc.
+		if isEscapedSeparator(arg) {
+			arg = arg[1:]
+		}
+
+		// Append arg to the last command in the chain.
+		wgoCmd.ArgsList[n] = append(wgoCmd.ArgsList[n], arg)
+	}
+
+	// With -ssh, the binary is copied to the remote host and run there
+	// instead. The binary is copied next to the old binary and then renamed
+	// over it, because a running binary can't be overwritten ("text file
+	// busy"). ssh -tt allocates a remote terminal so that the remote binary
+	// is sent SIGHUP when the ssh connection is closed.
+	if wgoCmd.SSH != "" {
+		if wgoCmd.SSHPath == "" {
+			pkg := wgoCmd.ArgsList[0][len(wgoCmd.ArgsList[0])-1]
+			if strings.HasSuffix(pkg, ".go") {
+				pkg = filepath.Dir(pkg)
+			}
+			pkg, err = filepath.Abs(filepath.Join(wgoCmd.dir(0), pkg))
+			if err != nil {
+				return nil, fmt.Errorf("-ssh: %w", err)
+			}
+			wgoCmd.SSHPath = "/tmp/wgo_" + filepath.Base(pkg)
+		}
+		tmpPath := wgoCmd.SSHPath + ".tmp"
+		script := "chmod +x " + shellQuote(tmpPath) + " && mv -f " + shellQuote(tmpPath) + " " + shellQuote(wgoCmd.SSHPath) +
+			" && exec " + shellQuote(wgoCmd.SSHPath, wgoCmd.ArgsList[1][1:]...)
+		copyArgs := []string{"scp", "-q", wgoCmd.binPath, wgoCmd.SSH + ":" + tmpPath}
+		sshArgs := []string{"ssh", "-tt", wgoCmd.SSH, script}
+		wgoCmd.replaceRunCommand(copyArgs, sshArgs)
+	}
+
+	// With -docker, the container is stopped so that its binary can be
+	// replaced, then started again. `docker start -a` streams the output of
+	// the container and forwards the signal that stops it to the container,
+	// which stops the container as well.
+	if dockerTarget != "" {
+		if len(wgoCmd.ArgsList[1]) > 1 {
+			return nil, fmt.Errorf("-docker: the arguments of the binary must be set in the command of the container")
+		}
+		container := dockerTarget[:strings.Index(dockerTarget, ":")]
+		wgoCmd.replaceRunCommand(
+			[]string{"docker", "stop", container},
+			[]string{"docker", "cp", wgoCmd.binPath, dockerTarget},
+			[]string{"docker", "start", "-a", container},
+		)
+	}
+
+	// With -kube, the binary is run in the pod with `kubectl exec`. Stopping
+	// kubectl doesn't stop the process in the pod, so the shell script that
+	// starts the binary records its PID and the next script (or the teardown
+	// when wgo exits) kills it. Like -ssh, the binary is copied next to the
+	// old binary and renamed over it.
+	if kubeTarget != "" {
+		i := strings.Index(kubeTarget, ":")
+		pod, path := kubeTarget[:i], kubeTarget[i+1:]
+		execArgs := []string{"kubectl", "exec"}
+		if j := strings.Index(pod, "/"); j >= 0 {
+			execArgs = append(execArgs, "-n", pod[:j])
+			pod = pod[j+1:]
+		}
+		execArgs = append(execArgs, pod, "--", "sh", "-c")
+		tmpPath, pidPath := path+".tmp", path+".pid"
+		kill := "[ -f " + shellQuote(pidPath) + " ] && kill $(cat " + shellQuote(pidPath) + ") 2>/dev/null"
+		script := kill + "; chmod +x " + shellQuote(tmpPath) + " && mv -f " + shellQuote(tmpPath) + " " + shellQuote(path) +
+			" && echo $$ > " + shellQuote(pidPath) + " && exec " + shellQuote(path, wgoCmd.ArgsList[1][1:]...)
+		wgoCmd.replaceRunCommand(
+			[]string{"kubectl", "cp", wgoCmd.binPath, kubeTarget + ".tmp"},
+			append(execArgs[:len(execArgs):len(execArgs)], script),
+		)
+		wgoCmd.Teardown = append(wgoCmd.Teardown, joinArgs(append(execArgs, kill)))
+	}
+	if len(wgoCmd.KubeRollout) > 0 {
+		wgoCmd.ArgsList = append(wgoCmd.ArgsList, append([]string{"kubectl", "rollout", "restart"}, wgoCmd.KubeRollout...))
+	}
+	if len(wgoCmd.ComposeRestart) > 0 {
+		wgoCmd.ArgsList = append(wgoCmd.ArgsList, append([]string{"docker", "compose", "restart"}, wgoCmd.ComposeRestart...))
+	}
+	if len(wgoCmd.ComposeUp) > 0 {
+		wgoCmd.ArgsList = append(wgoCmd.ArgsList, append([]string{"docker", "compose", "up", "--build", "-d"}, wgoCmd.ComposeUp...))
+	}
+	return &wgoCmd, nil
+}
+
+// replaceRunCommand replaces the command that runs the binary of `wgo run`
+// (ArgsList[1]) with the commands in argsList, which are run one after another.
+func (wgoCmd *WgoCmd) replaceRunCommand(argsList ...[]string) {
+	wgoCmd.ArgsList = append(append(wgoCmd.ArgsList[:1:1], argsList...), wgoCmd.ArgsList[2:]...)
+	blanks := make([]string, len(argsList)-1)
+	if len(wgoCmd.Dirs) > 1 {
+		wgoCmd.Dirs = append(append(wgoCmd.Dirs[:1:1], blanks...), wgoCmd.Dirs[1:]...)
+	}
+	if len(wgoCmd.Waits) > 1 {
+		wgoCmd.Waits = append(append(wgoCmd.Waits[:1:1], blanks...), wgoCmd.Waits[1:]...)
+	}
+	if len(wgoCmd.Separators) > 1 {
+		wgoCmd.Separators = append(append(wgoCmd.Separators[:1:1], blanks...), wgoCmd.Separators[1:]...)
+	}
+}
+
+// Run runs the WgoCmd until its context is canceled (or, if Exit is true,
+// until the last command exits). It may only be called once.
+func (wgoCmd *WgoCmd) Run() error {
+	if wgoCmd.Stdin == nil {
+		wgoCmd.Stdin = os.Stdin
+	}
+	if wgoCmd.Stdout == nil {
+		wgoCmd.Stdout = os.Stdout
+	}
+	if wgoCmd.Stderr == nil {
+		wgoCmd.Stderr = os.Stderr
+	}
+	if wgoCmd.MergeOutput {
+		wgoCmd.Stderr = wgoCmd.Stdout
+	}
+	// Only color the prefix of the messages if they're going straight to a
+	// terminal.
+	color := 0
+	if file, ok := wgoCmd.Stderr.(*os.File); ok && os.Getenv("NO_COLOR") == "" && supportsColor(file) {
+		color = wgoCmd.color
+	}
+	wgoCmd.tag = logPrefix(wgoCmd.Name, color)
+	if wgoCmd.OutputFilter != "" {
+		filter := &outputFilter{
+			wgoCmd: wgoCmd,
+			stdout: wgoCmd.Stdout,
+			stderr: wgoCmd.Stderr,
+		}
+		defer filter.Close()
+		wgoCmd.Stdout = filter
+		wgoCmd.Stderr = filter
+	}
+	// Keep the recent output around to show in the browser (or send to the
+	// webhooks, or report with `wgo last-error`) when the build fails.
+	if wgoCmd.Proxy != "" || wgoCmd.LiveReload != "" || len(wgoCmd.Webhooks) > 0 || wgoCmd.ControlSocket != "" || wgoCmd.OnBuildFailure != nil || wgoCmd.FailureFormat == "github" {
+		wgoCmd.output = &outputTail{}
+		wgoCmd.Stdout = io.MultiWriter(wgoCmd.Stdout, wgoCmd.output)
+		wgoCmd.Stderr = io.MultiWriter(wgoCmd.Stderr, wgoCmd.output)
+	}
+	if wgoCmd.Logger == nil {
+		wgoCmd.Logger = defaultLogger
+	}
+	// wgo's messages and logs go to Stderr (unless Quiet is set) and the log
+	// file.
+	wgoCmd.messages = wgoCmd.Stderr
+	logOutput := wgoCmd.Logger.Writer()
+	if wgoCmd.Quiet {
+		wgoCmd.messages = io.Discard
+		logOutput = io.Discard
+	}
+	if wgoCmd.LogFile != "" {
+		size := int64(wgoCmd.LogFileSize)
+		if size == 0 {
+			size = defaultLogFileSize
+		}
+		logFile, err := openRotatingFile(wgoCmd.LogFile, size)
+		if err != nil {
+			return fmt.Errorf("-log-file: %w", err)
+		}
+		defer logFile.Close()
+		if wgoCmd.LogFileOutput {
+			merged := wgoCmd.Stderr == wgoCmd.Stdout
+			wgoCmd.Stdout = io.MultiWriter(wgoCmd.Stdout, logFile)
+			if merged {
+				wgoCmd.Stderr = wgoCmd.Stdout
+			} else {
+				wgoCmd.Stderr = io.MultiWriter(wgoCmd.Stderr, logFile)
+			}
+		}
+		if wgoCmd.LogFileOutput && !wgoCmd.Quiet {
+			wgoCmd.messages = wgoCmd.Stderr
+		} else {
+			wgoCmd.messages = io.MultiWriter(wgoCmd.messages, logFile)
+		}
+		logOutput = io.MultiWriter(logOutput, logFile)
+	}
+	if wgoCmd.Logger != defaultLogger {
+		wgoCmd.Logger.SetOutput(logOutput)
+	}
+	atomic.StoreInt64(&wgoCmd.started, time.Now().UnixNano())
+	if wgoCmd.LogFormat == "json" {
+		wgoCmd.jsonLog = &jsonLogWriter{w: wgoCmd.messages, name: wgoCmd.Name, started: &wgoCmd.started}
+		if wgoCmd.Logger != defaultLogger {
+			wgoCmd.Logger.SetPrefix("")
+			wgoCmd.Logger.SetOutput(&jsonLogWriter{w: wgoCmd.Logger.Writer(), name: wgoCmd.Name, started: &wgoCmd.started})
+		}
+	} else if wgoCmd.Logger != defaultLogger {
+		wgoCmd.Logger.SetPrefix(wgoCmd.tag)
+		if wgoCmd.Timestamps {
+			output := newPrefixWriter(wgoCmd.Logger.Writer(), "")
+			output.stamp = wgoCmd.timestamp
+			wgoCmd.Logger.SetOutput(output)
+		}
+	}
+	if wgoCmd.Label {
+		wgoCmd.labels = make([]string, len(wgoCmd.ArgsList))
+		for i := range wgoCmd.ArgsList {
+			wgoCmd.labels[i] = wgoCmd.label(i)
+		}
+		uniqueNames(wgoCmd.labels)
+		for i, label := range wgoCmd.labels {
+			wgoCmd.labels[i] = colorize("["+label+"]", color) + " "
+		}
+	}
+	for i := range wgoCmd.Roots {
+		var err error
+		wgoCmd.Roots[i], err = filepath.Abs(wgoCmd.Roots[i])
+		if err != nil {
+			return err
+		}
+	}
+	// Editing a module that is replaced by a local directory in go.mod should
+	// rebuild the binary of `wgo run`, so watch the directory as well.
+	if wgoCmd.isRun && !wgoCmd.StdinFiles {
+		dirs, err := replaceDirs(wgoCmd.dir(0))
+		if err != nil {
+			wgoCmd.Logger.Println("go.mod:", err)
+		}
+	REPLACE_DIRS:
+		for _, dir := range dirs {
+			for _, root := range wgoCmd.Roots {
+				if dir == root || strings.HasPrefix(dir, root+string(filepath.Separator)) {
+					continue REPLACE_DIRS
+				}
+			}
+			wgoCmd.Roots = append(wgoCmd.Roots, dir)
+		}
+	}
+	if wgoCmd.binPath != "" && !wgoCmd.keepBin {
+		defer os.Remove(wgoCmd.binPath)
+		dir := filepath.Dir(wgoCmd.binPath)
+		removed, err := removeStaleBinaries(dir)
+		if err != nil {
+			wgoCmd.Logger.Println(err)
+		}
+		if removed > 0 {
+			wgoCmd.Logger.Printf("removed %d stale binaries from %s", removed, dir)
+		}
+	}
+	// The files that wgo itself writes to must not trigger a reload, otherwise
+	// every line written to the daemon log would restart the commands.
+	ownFiles := []string{wgoCmd.ControlSocket}
+	if wgoCmd.Record != "" {
+		ownFiles = append(ownFiles, wgoCmd.Record)
+	}
+	if wgoCmd.Events != "" && !strings.HasPrefix(wgoCmd.Events, "fd:") {
+		ownFiles = append(ownFiles, strings.TrimPrefix(wgoCmd.Events, "unix:"))
+	}
+	if wgoCmd.LogFile != "" {
+		ownFiles = append(ownFiles, wgoCmd.LogFile)
+		for i := 1; i <= logFileBackups; i++ {
+			ownFiles = append(ownFiles, wgoCmd.LogFile+"."+strconv.Itoa(i))
+		}
+	}
+	if wgoCmd.keepBin {
+		ownFiles = append(ownFiles, wgoCmd.binPath)
+	}
+	if wgoCmd.Daemon {
+		ownFiles = append(ownFiles, wgoCmd.PIDFile, wgoCmd.DaemonLog)
+		if wgoCmd.PIDFile == "" {
+			ownFiles = append(ownFiles, defaultPIDFile)
+		}
+		if wgoCmd.DaemonLog == "" {
+			ownFiles = append(ownFiles, defaultDaemonLog)
+		}
+	}
+	wgoCmd.ownFiles = make(map[string]struct{})
+	for _, file := range ownFiles {
+		if file == "" {
+			continue
+		}
+		file, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		wgoCmd.ownFiles[file] = struct{}{}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return &WatcherSetupError{Err: err}
+	}
+	defer watcher.Close()
+	wgoCmd.watcher = watcher
+	if wgoCmd.Record != "" {
+		if wgoCmd.recFile == nil || wgoCmd.recFile.path != wgoCmd.Record {
+			wgoCmd.recFile = &recordFile{path: wgoCmd.Record}
+		}
+		wgoCmd.recorder, err = newEventRecorder(wgoCmd.recFile, wgoCmd.Name, wgoCmd.Roots[0])
+		if err != nil {
+			return fmt.Errorf("-record: %w", err)
+		}
+		defer wgoCmd.recorder.Close()
+	}
+	// files is the set of files to watch if the list of files is read from
+	// Stdin. fsnotify loses track of a file once an editor replaces it with a
+	// new one, so the files' parent directories are watched instead.
+	var files map[string]struct{}
+	if wgoCmd.StdinFiles {
+		files, err = readFileList(wgoCmd.Stdin)
+		if err != nil {
+			return fmt.Errorf("-stdin-files: %w", err)
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("-stdin-files: no files provided")
+		}
+		dirs := make(map[string]struct{})
+		for file := range files {
+			wgoCmd.Logger.Println("WATCH", filepath.ToSlash(file))
+			dir := filepath.Dir(file)
+			if _, ok := dirs[dir]; ok {
+				continue
+			}
+			dirs[dir] = struct{}{}
+			err = watcher.Add(dir)
+			if err != nil {
+				return fmt.Errorf("-stdin-files: %w", &WatcherSetupError{Path: dir, Err: err})
+			}
+		}
+	} else {
+		if wgoCmd.isRun {
+			wgoCmd.updatePackages()
+		}
+		// Nothing works if a root can't be watched, but a subdirectory that
+		// can't be watched (such as one that isn't readable) is only
+		// reported.
+		for _, root := range wgoCmd.Roots {
+			err := wgoCmd.addDirsRecursively(watcher, root)
+			if err != nil {
+				var setupErr *WatcherSetupError
+				if errors.As(err, &setupErr) && setupErr.Path == root {
+					return err
+				}
+				wgoCmd.message(err.Error())
+			}
+		}
+	}
+	// Timer is used to debounce events. Each event does not directly trigger a
+	// reload, it only resets the timer. Only when the timer is allowed to
+	// fully expire will the reload actually occur.
+	timer := time.NewTimer(0)
+	timer.Stop()
+	wgoCmd.controls = make(chan control)
+	wgoCmd.calls = make(chan func())
+	wgoCmd.runDone = make(chan struct{})
+	defer close(wgoCmd.runDone)
+	// When replaying a recording, the event loop gets the recorded events
+	// instead of the file events. The directories are still watched (and
+	// logged) as usual, but their events are never read.
+	fileEvents := watcher.Events
+	if wgoCmd.replay != nil {
+		replayed := make(chan fsnotify.Event)
+		go wgoCmd.replayEvents(replayed)
+		fileEvents = replayed
+	}
+	if wgoCmd.Batches != nil {
+		defer close(wgoCmd.Batches)
+		wgoCmd.sendBatches(watcher, fileEvents, files)
+		return nil
+	}
+	// The stdin broker owns wgoCmd.Stdin for the lifetime of Run, so that a
+	// command being restarted never has to wait for the next read from Stdin
+	// to complete. If keyboard controls are enabled, they sit in front of the
+	// stdin broker and filter out the controls.
+	enableStdin := wgoCmd.EnableStdin || wgoCmd.BroadcastStdin
+	stdinSource := wgoCmd.Stdin
+	if wgoCmd.EnableKeys {
+		if file, ok := wgoCmd.Stdin.(*os.File); ok && isTerminal(file) {
+			if enableStdin {
+				pipeReader, pipeWriter := io.Pipe()
+				go wgoCmd.readControlLines(file, pipeWriter)
+				stdinSource = pipeReader
+			} else {
+				restore, err := setCbreakMode(file)
+				if err != nil {
+					wgoCmd.Logger.Println("-keys:", err)
+				} else {
+					defer restore()
+					go wgoCmd.readControlKeys(file)
+				}
+			}
+		}
+	}
+	var stdin *stdinBroker
+	if enableStdin {
+		stdin = newStdinBroker(stdinSource)
+	}
+	// The sockets passed to the last command stay open for the lifetime of
+	// Run so that the port never closes between restarts.
+	listenFiles := append([]*os.File(nil), wgoCmd.ListenFiles...)
+	listenNames := make([]string, 0, len(wgoCmd.ListenFiles)+len(wgoCmd.Bind))
+	for _, file := range wgoCmd.ListenFiles {
+		listenNames = append(listenNames, file.Name())
+	}
+	for _, addr := range wgoCmd.Bind {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("-bind: %w", err)
+		}
+		file, err := ln.(*net.TCPListener).File()
+		ln.Close() // The file is a duplicate, so the socket stays open.
+		if err != nil {
+			return fmt.Errorf("-bind: %w", err)
+		}
+		defer file.Close()
+		listenFiles = append(listenFiles, file)
+		// systemd uses "unknown" for sockets without a name.
+		listenNames = append(listenNames, "unknown")
+		wgoCmd.Logger.Println("BIND", ln.Addr().String())
+	}
+	if wgoCmd.Listen != "" {
+		ln, err := net.Listen("tcp", wgoCmd.Listen)
+		if err != nil {
+			return fmt.Errorf("-listen: %w", err)
+		}
+		server := &http.Server{Handler: http.HandlerFunc(wgoCmd.handleControl)}
+		go server.Serve(ln)
+		defer server.Close()
+		wgoCmd.Logger.Println("LISTEN", ln.Addr().String())
+	}
+	var config *tls.Config
+	if wgoCmd.TLS {
+		config, err = tlsConfig(wgoCmd.TLSCert, wgoCmd.TLSKey)
+		if err != nil {
+			return fmt.Errorf("-tls: %w", err)
+		}
+	}
+	var liveReloadAddr string
+	if wgoCmd.LiveReload != "" {
+		ln, err := net.Listen("tcp", wgoCmd.LiveReload)
+		if err != nil {
+			return fmt.Errorf("-livereload: %w", err)
+		}
+		if config != nil {
+			ln = tls.NewListener(ln, config)
+		}
+		wgoCmd.reloader = newLiveReload()
+		server := &http.Server{Handler: wgoCmd.reloader}
+		go server.Serve(ln)
+		defer server.Close()
+		liveReloadAddr = ln.Addr().String()
+		wgoCmd.Logger.Println("LIVERELOAD", liveReloadAddr)
+	}
+	if len(wgoCmd.Webhooks) > 0 {
+		wgoCmd.webhook = newWebhook(wgoCmd.Webhooks, wgoCmd.messages)
+		defer wgoCmd.webhook.close()
+	}
+	if wgoCmd.Events != "" {
+		wgoCmd.events, err = openEventStream(wgoCmd.Events)
+		if err != nil {
+			return fmt.Errorf("-events: %w", err)
+		}
+		defer wgoCmd.events.Close()
+	}
+	if wgoCmd.Proxy != "" {
+		wgoCmd.proxy, err = newDevProxy(wgoCmd.Proxy, time.Minute)
+		if err != nil {
+			return fmt.Errorf("-proxy: %w", err)
+		}
+		if liveReloadAddr != "" {
+			wgoCmd.proxy.snippet = liveReloadSnippet(liveReloadAddr, config != nil)
+		}
+		ln, err := net.Listen("tcp", wgoCmd.ProxyListen)
+		if err != nil {
+			return fmt.Errorf("-proxy-listen: %w", err)
+		}
+		if config != nil {
+			ln = tls.NewListener(ln, config)
+		}
+		server := &http.Server{Handler: wgoCmd.proxy}
+		go server.Serve(ln)
+		defer server.Close()
+		wgoCmd.Logger.Println("PROXY", ln.Addr().String(), "=>", wgoCmd.Proxy)
+	}
+	if wgoCmd.ControlSocket != "" {
+		ln, err := listenUnixSocket(wgoCmd.ControlSocket)
+		if err != nil {
+			return fmt.Errorf("-socket: %w", err)
+		}
+		go wgoCmd.serveControlSocket(ln)
+		defer ln.Close()
+		wgoCmd.Logger.Println("LISTEN", wgoCmd.ControlSocket)
+	}
+	wgoCmd.paused = false
+	wgoCmd.runs = 0
+	// Scripts can pause and resume wgo with signals (SIGUSR1 and SIGUSR2)
+	// e.g. around a large `git checkout`, unless the signals are forwarded to
+	// the commands instead. Not supported on Windows.
+	var forwarded chan os.Signal
+	if wgoCmd.ForwardSignals && len(forwardSignals) > 0 {
+		forwarded = make(chan os.Signal, 1)
+		signal.Notify(forwarded, forwardSignals...)
+		defer signal.Stop(forwarded)
+	} else if pauseSignal != nil {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, pauseSignal, resumeSignal)
+		defer signal.Stop(signals)
+		go func() {
+			for {
+				select {
+				case <-wgoCmd.runDone:
+					return
+				case sig := <-signals:
+					c := controlResume
+					if sig == pauseSignal {
+						c = controlPause
+					}
+					if !wgoCmd.sendControl(c) {
+						return
+					}
+				}
+			}
+		}()
+	}
+	// If the last command runs in a pseudo-terminal, keep its size in sync
+	// with the terminal wgo is running in.
+	var resized chan struct{}
+	if wgoCmd.PTY {
+		resized = make(chan struct{}, 1)
+		stopResize := notifyResize(resized)
+		defer stopResize()
+	}
+
+	wgoCmd.env, err = wgoCmd.environ()
+	if err != nil {
+		return err
+	}
+	defer wgoCmd.runHooks("teardown", wgoCmd.Teardown)
+	for _, script := range wgoCmd.Setup {
+		cmd, err := wgoCmd.shellCommand(script)
+		if err != nil {
+			return err
+		}
+		err = cmd.Start()
+		if err != nil {
+			return err
+		}
+		waitDone := make(chan error, 1)
+		go func() {
+			waitDone <- cmd.Wait()
+		}()
+		select {
+		case <-wgoCmd.ctx.Done():
+			stop(cmd)
+			<-waitDone
+			return nil
+		case err := <-waitDone:
+			if err != nil {
+				return fmt.Errorf("-setup %q: %w", script, err)
+			}
+		}
+	}
+	for _, target := range wgoCmd.WaitFor {
+		if probe(wgoCmd.ctx, target) == nil {
+			continue
+		}
+		wgoCmd.message("waiting for " + target)
+		if waitForProbe(wgoCmd.ctx, target) != nil {
+			return nil
+		}
+	}
+
+	// In overlap mode (or with KeepRunning), stopPrevious stops the old
+	// instance of the last command that is kept running while the commands
+	// are restarted.
+	var stopPrevious func() bool
+	var previousBinPath string // The binary of the old instance, for `wgo run`.
+	defer func() {
+		if stopPrevious != nil && stopPrevious() {
+			wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+		}
+	}()
+	// The new binary of `wgo run` can't be built over the old binary while the
+	// old binary is still running, so alternate between two binaries.
+	var altBinPath string
+	if (wgoCmd.Overlap || wgoCmd.KeepRunning) && wgoCmd.binPath != "" {
+		ext := filepath.Ext(wgoCmd.binPath)
+		altBinPath = strings.TrimSuffix(wgoCmd.binPath, ext) + "_alt" + ext
+		defer os.Remove(altBinPath)
+		wgoCmd.ownFiles[altBinPath] = struct{}{}
+	}
+	currentBinPath := wgoCmd.binPath
+	// builds are the copies of the most recent binaries kept by KeepBuilds,
+	// oldest first. buildIndex is the index of the build that is running, and
+	// rollbackBinPath is the build to roll back to on the next run.
+	var builds []string
+	var buildIndex int
+	var rollbackBinPath string
+	defer func() {
+		for _, build := range builds {
+			os.Remove(build)
+		}
+	}()
+	wgoCmd.sessionStart = time.Now()
+	// If wgo was started by systemd with Type=notify, keep systemd informed
+	// of when the commands are ready and when they are being restarted.
+	if wgoCmd.notifySocket == "" {
+		wgoCmd.notifySocket = os.Getenv("NOTIFY_SOCKET")
+	}
+	defer wgoCmd.notify("STOPPING=1")
+	// changedDirs are the directories of the files that changed since the
+	// commands were last started, for Generate. generated holds the
+	// modification times of the files written by `go generate`, so that they
+	// don't trigger yet another restart. changedFiles are the files that
+	// changed, for Sync.
+	changedDirs := make(map[string]struct{})
+	changedFiles := make(map[string]struct{})
+	generated := make(map[string]time.Time)
+	for {
+		if wgoCmd.Clear {
+			clearScreen(wgoCmd.Stdout)
+		}
+		atomic.StoreInt64(&wgoCmd.started, time.Now().UnixNano())
+		wgoCmd.cycleStart = time.Now()
+		if wgoCmd.pane != nil {
+			if wgoCmd.isRun {
+				wgoCmd.pane.start("building")
+			} else {
+				wgoCmd.pane.start("starting")
+			}
+		}
+		if wgoCmd.output != nil {
+			wgoCmd.output.Reset()
+		}
+		wgoCmd.problemMarker("BUILD START")
+		if wgoCmd.runs > 0 {
+			wgoCmd.notify("RELOADING=1")
+			wgoCmd.emit(lifecycleEvent{Event: "restart"})
+			if wgoCmd.webhook != nil {
+				wgoCmd.webhook.send(webhookEvent{Event: "restart", Text: "wgo: restarting"})
+			}
+			if wgoCmd.OnBeforeRestart != nil {
+				wgoCmd.OnBeforeRestart()
+			}
+			// The old instance of the last command is gone (unless it is
+			// kept running), so requests must wait for the new one.
+			if wgoCmd.proxy != nil && stopPrevious == nil {
+				wgoCmd.proxy.hold()
+			}
+			// Pick up any changes to the -env-file files and the output of
+			// the -env-cmd scripts.
+			env, err := wgoCmd.environ()
+			if wgoCmd.ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				wgoCmd.message(err.Error() + ", keeping the previous environment")
+			} else {
+				wgoCmd.env = env
+			}
+		}
+		if len(changedDirs) > 0 {
+			wgoCmd.generate(changedDirs, generated)
+			changedDirs = make(map[string]struct{})
+		}
+		if len(changedFiles) > 0 {
+			wgoCmd.sync(changedFiles)
+			changedFiles = make(map[string]struct{})
+		}
+		// The imports and //go:embed directives may have changed since the
+		// last run, so watch the directories of newly imported packages and
+		// embedded files.
+		if wgoCmd.isRun && wgoCmd.runs > 0 {
+			newDirs := wgoCmd.updatePackages()
+			if files == nil {
+				for _, dir := range newDirs {
+					// Directories outside the roots (such as the module
+					// cache) are not watched.
+					for _, root := range wgoCmd.Roots {
+						if dir == root || strings.HasPrefix(dir, root+string(filepath.Separator)) {
+							err := wgoCmd.addDirsRecursively(watcher, dir)
+							if err != nil {
+								wgoCmd.message(err.Error())
+							}
+							break
+						}
+					}
+				}
+			}
+		}
+		if altBinPath != "" && stopPrevious != nil && currentBinPath == previousBinPath {
+			nextBinPath := altBinPath
+			if currentBinPath == altBinPath {
+				nextBinPath = wgoCmd.binPath
+			}
+			for _, args := range wgoCmd.ArgsList {
+				for k := range args {
+					if args[k] == currentBinPath {
+						args[k] = nextBinPath
+					}
+				}
+			}
+			currentBinPath = nextBinPath
+		}
+		wgoCmd.runHooks("on-start", wgoCmd.OnStart)
+		wgoCmd.runs++
+		// A run counts as at most one failure, even if its -ready-url fails
+		// and then its server exits with an error.
+		failed := false
+		countFailure := func() {
+			if !failed {
+				failed = true
+				wgoCmd.failures++
+			}
+		}
+	CMD_CHAIN:
+		for i := 0; i < len(wgoCmd.ArgsList); i++ {
+			// Step 1: Prepare the commands. Commands joined by the ":&:" or
+			// ":|:" separators form a group that is run in parallel, so the
+			// group spans ArgsList[i] to ArgsList[j].
+			j := i
+			for j < len(wgoCmd.ArgsList)-1 && (wgoCmd.separator(j) == ":&:" || wgoCmd.separator(j) == ":|:") {
+				j++
+			}
+			isLast := j == len(wgoCmd.ArgsList)-1
+			// Rolling back only restarts the last command with an older
+			// binary, nothing needs to be built.
+			if rollbackBinPath != "" && !isLast {
+				i = j
+				continue
+			}
+			// If the new binary of `wgo run` is identical to the binary of
+			// the old instance kept by -keep-running, the old instance is
+			// kept and the last command is not started at all.
+			// An old instance that was rolled back to an older build is
+			// always replaced.
+			unchanged := isLast && wgoCmd.SkipIdentical && stopPrevious != nil && !wgoCmd.Overlap &&
+				(len(builds) == 0 || buildIndex == len(builds)-1) && currentBinPath != previousBinPath && sameBinary(wgoCmd.goCommand(), currentBinPath, previousBinPath)
+			if unchanged {
+				wgoCmd.Logger.Println("the binary is unchanged, keeping the old instance of the last command running")
+			}
+			groupStart := time.Now()
+			if isLast {
+				wgoCmd.lastStart = groupStart
+				if wgoCmd.pane != nil && !unchanged {
+					wgoCmd.pane.setStatus("starting")
+				}
+			}
+			if wgoCmd.CI && !unchanged {
+				wgoCmd.startGroup(i, j)
+			}
+			cmds := make([]*exec.Cmd, 0, j-i+1)
+			// pipeFiles are the parent's copies of the pipes between commands
+			// joined by ":|:". They must be closed once the commands have
+			// started, otherwise the reading command never sees EOF.
+			var pipeFiles []*os.File
+			// ptyIndex is the index of the command in cmds that should be
+			// started in a pseudo-terminal, if any. stdinPipes holds the stdin
+			// of each command in cmds that reads from wgoCmd.Stdin.
+			ptyIndex := -1
+			stdinPipes := make([]io.WriteCloser, 0, j-i+1)
+			// dump captures the stderr of the last command for -dump-on-hang.
+			var dump *dumpWriter
+			closePipeFiles := func() {
+				for _, file := range pipeFiles {
+					file.Close()
+				}
+			}
+			for k := i; k <= j && !unchanged; k++ {
+				args := wgoCmd.ArgsList[k]
+				if k == 0 && wgoCmd.ldflags > 0 {
+					args = append([]string(nil), args...)
+					args[wgoCmd.ldflags] = strings.TrimSpace(args[wgoCmd.ldflags] + " " + wgoCmd.versionLdflags())
+				}
+				if wgoCmd.Expand {
+					args = wgoCmd.expandArgs(args)
+				}
+				if rollbackBinPath != "" {
+					args = append([]string(nil), args...)
+					for n := range args {
+						if args[n] == currentBinPath {
+							args[n] = rollbackBinPath
+						}
+					}
+				}
+				cmd, err := wgoCmd.command(args)
+				wgoCmd.Logger.Println("EXECUTING", joinArgs(wgoCmd.maskArgs(args)))
+				if err != nil {
+					closePipeFiles()
+					return err
+				}
+				cmd.Dir = wgoCmd.dir(k)
+				if wgoCmd.Label || wgoCmd.TimestampOutput || wgoCmd.FailureFormat == "vscode" {
+					// With MergeOutput, both streams must keep sharing the
+					// same writer so that they stay in order.
+					stdout := wgoCmd.outputWriter(cmd.Stdout, k)
+					if cmd.Stderr == cmd.Stdout {
+						cmd.Stderr = stdout
+					} else {
+						cmd.Stderr = wgoCmd.outputWriter(cmd.Stderr, k)
+					}
+					cmd.Stdout = stdout
+				}
+				if k > i && wgoCmd.separator(k-1) == ":|:" {
+					pipeReader, pipeWriter, err := os.Pipe()
+					if err != nil {
+						closePipeFiles()
+						return err
+					}
+					pipeFiles = append(pipeFiles, pipeReader, pipeWriter)
+					cmds[len(cmds)-1].Stdout = pipeWriter
+					cmd.Stdin = pipeReader
+				}
+				// If the user enabled it, feed wgoCmd.Stdin to the command's
+				// Stdin. Unless stdin is broadcast, only the last command gets
+				// to read from Stdin -- the commands in the middle are usually
+				// build steps which aren't expecting any input.
+				//
+				// We have to use cmd.StdinPipe() here instead of assigning
+				// cmd.Stdin directly, otherwise `wgo run ./testdata/stdin`
+				// doesn't work interactively (the tests will pass, but somehow
+				// it won't actually work if you run it in person. I don't know
+				// why).
+				if len(wgoCmd.Rlimits) > 0 && k == len(wgoCmd.ArgsList)-1 {
+					err = setRlimits(cmd, wgoCmd.Rlimits)
+					if err != nil {
+						closePipeFiles()
+						return fmt.Errorf("-rlimit: %w", err)
+					}
+				}
+				if len(listenFiles) > 0 && k == len(wgoCmd.ArgsList)-1 {
+					err = passListenFiles(cmd, listenFiles, listenNames)
+					if err != nil {
+						closePipeFiles()
+						return fmt.Errorf("-bind: %w", err)
+					}
+				}
+				var stdinPipe io.WriteCloser
+				if wgoCmd.PTY && k == len(wgoCmd.ArgsList)-1 {
+					// The pseudo-terminal takes over the command's output
+					// (and stdin, if the command isn't reading from a pipe).
+					cmd.Stdout = nil
+					cmd.Stderr = nil
+					ptyIndex = len(cmds)
+				} else if enableStdin && (wgoCmd.BroadcastStdin || k == len(wgoCmd.ArgsList)-1) && cmd.Stdin == nil {
+					stdinPipe, err = cmd.StdinPipe()
+					if err != nil {
+						closePipeFiles()
+						return err
+					}
+				}
+				if wgoCmd.DumpFile != "" && k == len(wgoCmd.ArgsList)-1 && cmd.Stderr != nil {
+					dump = &dumpWriter{w: cmd.Stderr}
+					cmd.Stderr = dump
+				}
+				cmds = append(cmds, cmd)
+				stdinPipes = append(stdinPipes, stdinPipe)
+			}
+
+			// The build succeeded, keep a copy of the binary to roll back to.
+			if isLast && wgoCmd.KeepBuilds > 0 && rollbackBinPath == "" && !unchanged {
+				// The run number makes the name of every copy unique.
+				ext := filepath.Ext(wgoCmd.binPath)
+				build := strings.TrimSuffix(wgoCmd.binPath, ext) + "_build" + strconv.Itoa(wgoCmd.runs) + ext
+				err := copyFile(build, currentBinPath)
+				if err != nil {
+					wgoCmd.message("-keep-builds: " + err.Error())
+				} else {
+					wgoCmd.ownFiles[build] = struct{}{}
+					builds = append(builds, build)
+					for len(builds) > wgoCmd.KeepBuilds {
+						os.Remove(builds[0])
+						builds = builds[1:]
+					}
+					buildIndex = len(builds) - 1
+				}
+			}
+			rollbackBinPath = ""
+
+			// Step 2: Run the commands in the background. The commands
+			// before the last command have succeeded, so the old instance
+			// kept by -keep-running can be stopped now. The old instance
+			// kept by -overlap is expected to hold on to its ports, so don't
+			// wait for them.
+			if isLast && stopPrevious != nil && !wgoCmd.Overlap && !unchanged {
+				if wgoCmd.proxy != nil {
+					wgoCmd.proxy.hold()
+				}
+				if stopPrevious() {
+					wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+				}
+				stopPrevious = nil
+			}
+			if isLast && stopPrevious == nil && len(wgoCmd.WaitPorts) > 0 {
+				err := wgoCmd.waitPortsFree()
+				if err != nil {
+					wgoCmd.message("-wait-port: " + err.Error() + ", starting anyway")
+				}
+				if wgoCmd.ctx.Err() != nil {
+					closePipeFiles()
+					return nil
+				}
+			}
+			type result struct {
+				index int
+				err   error
+			}
+			cmdResults := make(chan result, len(cmds))
+			waitDone := make(chan struct{})
+			var cmdsDone sync.WaitGroup
+			var groupPTY io.ReadWriteCloser
+			var stdinWriters []io.Writer
+			for k, cmd := range cmds {
+				// Commands that depend on an earlier command in the group
+				// (e.g. on the server it starts) wait for it here.
+				if target := wgoCmd.wait(i + k); target != "" {
+					err := wgoCmd.waitDependency(target)
+					if wgoCmd.ctx.Err() != nil {
+						closePipeFiles()
+						for _, cmd := range cmds[:k] {
+							stop(cmd)
+						}
+						cmdsDone.Wait()
+						return nil
+					}
+					if err != nil {
+						wgoCmd.message("-wait: " + err.Error() + ", starting anyway")
+					}
+				}
+				var err error
+				var ptmx io.ReadWriteCloser
+				if k == ptyIndex {
+					ptmx, err = startPTY(cmd)
+				} else {
+					err = cmd.Start()
+				}
+				if err != nil {
+					closePipeFiles()
+					for _, cmd := range cmds[:k] {
+						stop(cmd)
+					}
+					cmdsDone.Wait()
+					return err
+				}
+				// The priority is set right after the command starts, which
+				// is before it has had a chance to start most of its child
+				// processes (which inherit the priority).
+				if wgoCmd.Nice != 0 {
+					err = setPriority(cmd.Process.Pid, wgoCmd.Nice)
+					if err != nil {
+						wgoCmd.message("-nice: " + err.Error())
+					}
+				}
+				// The first command of `wgo run` is the build.
+				isBuild := wgoCmd.isRun && i+k == 0
+				cmdStart := time.Now()
+				if isBuild {
+					wgoCmd.emit(lifecycleEvent{Event: "build_start", Command: joinArgs(wgoCmd.maskArgs(cmd.Args)), PID: cmd.Process.Pid})
+				} else {
+					wgoCmd.emit(lifecycleEvent{Event: "start", Command: joinArgs(wgoCmd.maskArgs(cmd.Args)), PID: cmd.Process.Pid})
+				}
+				var outputDone chan struct{}
+				if ptmx != nil {
+					groupPTY = ptmx
+					outputDone = make(chan struct{})
+					output := wgoCmd.Stdout
+					if wgoCmd.Label || wgoCmd.TimestampOutput || wgoCmd.FailureFormat == "vscode" {
+						output = wgoCmd.outputWriter(output, i+k)
+					}
+					go func() {
+						defer close(outputDone)
+						_, _ = io.Copy(output, ptmx)
+					}()
+				}
+				// stdinWriter is where the stdin broker forwards Stdin to. The
+				// pseudo-terminal is wrapped so that the broker can't close it
+				// when Stdin reaches EOF.
+				var stdinWriter io.Writer
+				if ptmx != nil && stdin != nil && cmd.Stdin == nil {
+					stdinWriter = struct{ io.Writer }{ptmx}
+				} else if stdinPipes[k] != nil {
+					stdinWriter = stdinPipes[k]
+				}
+				if stdinWriter != nil {
+					stdinWriters = append(stdinWriters, stdinWriter)
+				}
+				k, cmd := k, cmd
+				cmdsDone.Add(1)
+				go func() {
+					defer cmdsDone.Done()
+					err := cmd.Wait()
+					if stdinWriter != nil {
+						stdin.detach(stdinWriter)
+					}
+					if ptmx != nil {
+						waitPTY(ptmx, outputDone)
+					}
+					if wgoCmd.events != nil {
+						event := lifecycleEvent{Event: "exit", Command: joinArgs(wgoCmd.maskArgs(cmd.Args)), PID: cmd.Process.Pid}
+						if isBuild {
+							event.Event = "build_finish"
+							event.Duration = time.Since(cmdStart).Seconds()
+						}
+						if cmd.ProcessState != nil {
+							exitCode := cmd.ProcessState.ExitCode()
+							event.ExitCode = &exitCode
+						}
+						if err != nil {
+							event.Error = err.Error()
+						}
+						wgoCmd.emit(event)
+					}
+					if err != nil {
+						err = newProcessExitError(cmd, err)
+					}
+					cmdResults <- result{index: k, err: err}
+				}()
+			}
+			closePipeFiles()
+			// In overlap mode, wait for the new instance to be ready before
+			// stopping the old instance.
+			var overlapReady, readyURL chan error
+			if unchanged {
+				// The old instance is already ready.
+				wgoCmd.problemMarker("BUILD OK")
+			} else if isLast && stopPrevious != nil {
+				overlapReady = make(chan error, 1)
+				go func() {
+					overlapReady <- wgoCmd.waitOverlapReady()
+				}()
+			} else if isLast && wgoCmd.ReadyURL != "" {
+				readyURL = make(chan error, 1)
+				go func() {
+					readyURL <- wgoCmd.waitReady()
+				}()
+			} else if isLast {
+				wgoCmd.ready()
+			}
+			// Attach every command at once so that any type-ahead is
+			// broadcast to all of them, rather than only the first one to
+			// start.
+			if len(stdinWriters) > 0 {
+				stdin.attach(stdinWriters...)
+			}
+			go func() {
+				cmdsDone.Wait()
+				close(waitDone)
+			}()
+			// The watchdogs report a reason to restart the last command on
+			// the restart channel.
+			var restart chan error
+			if isLast && !unchanged && (wgoCmd.HealthURL != "" || wgoCmd.MaxMemory != 0) {
+				restart = make(chan error, 2)
+			}
+			if isLast && !unchanged && wgoCmd.HealthURL != "" {
+				go wgoCmd.checkHealth(waitDone, restart)
+			}
+			if isLast && !unchanged && wgoCmd.MaxMemory != 0 {
+				go wgoCmd.checkMemory(cmds[len(cmds)-1].Process.Pid, waitDone, restart)
+			}
+			if isLast && !unchanged && wgoCmd.StatsInterval != 0 {
+				go wgoCmd.reportStats(cmds[len(cmds)-1].Process.Pid, waitDone)
+			}
+
+			// stopRunning stops the commands that are still running and
+			// reports whether any command was stopped.
+			exited := make([]bool, len(cmds))
+			stopRunning := func() bool {
+				var stopped []*exec.Cmd
+				for k, cmd := range cmds {
+					if !exited[k] {
+						stop(cmd)
+						stopped = append(stopped, cmd)
+					}
+				}
+				if len(stopped) > 0 {
+					if !exited[len(cmds)-1] {
+						wgoCmd.waitStopped(stopped, dump, waitDone)
+					} else {
+						wgoCmd.waitStopped(stopped, nil, waitDone)
+					}
+				}
+				<-waitDone
+				wgoCmd.cmdsRunning = false
+				return len(stopped) > 0
+			}
+			wgoCmd.cmdsRunning = true
+
+			// Step 3: Wait for events in the event loop.
+			running := len(cmds)
+			var groupErr error
+			for {
+				select {
+				case <-wgoCmd.ctx.Done():
+					if stopRunning() {
+						wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+					}
+					return nil
+				case result := <-cmdResults:
+					exited[result.index] = true
+					running--
+					if result.err != nil {
+						wgoCmd.runHooks("on-error", wgoCmd.OnError)
+						if groupErr == nil {
+							groupErr = result.err
+						}
+					}
+					if running > 0 {
+						break
+					}
+					wgoCmd.cmdsRunning = false
+					wgoCmd.endGroup()
+					if wgoCmd.isRun && i == 0 && !isLast {
+						wgoCmd.builds++
+						wgoCmd.buildTime += time.Since(groupStart)
+					}
+					if isLast {
+						if groupErr != nil {
+							countFailure()
+						}
+						if wgoCmd.pane != nil {
+							if groupErr != nil {
+								wgoCmd.pane.setStatus("failed")
+							} else {
+								wgoCmd.pane.setStatus("exited")
+							}
+						}
+						// The assets built by the last command are ready.
+						if groupErr == nil && wgoCmd.reloader != nil {
+							wgoCmd.reloader.reload()
+						}
+						if wgoCmd.Exit {
+							// In CI, a failing last command (such as
+							// `go test ./...`) is reported like a failed
+							// build.
+							if wgoCmd.CI && groupErr != nil {
+								failure := wgoCmd.buildFailedError(j, groupErr)
+								wgoCmd.showFailure(failure)
+								return failure
+							}
+							return groupErr
+						}
+						break
+					}
+					if groupErr != nil && wgoCmd.separator(j) != ":;:" {
+						countFailure()
+						failure := wgoCmd.buildFailedError(j, groupErr)
+						wgoCmd.showFailure(failure)
+						if wgoCmd.CI {
+							return failure
+						}
+						if stopPrevious != nil {
+							wgoCmd.message("keeping the old instance of the last command running")
+						}
+						break
+					}
+					i = j
+					continue CMD_CHAIN
+				case err := <-restart:
+					wgoCmd.message(err.Error() + ", restarting")
+					timer.Stop()
+					if stopRunning() {
+						wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+					}
+					break CMD_CHAIN
+				case <-resized:
+					if groupPTY != nil && !exited[ptyIndex] {
+						_ = resizePTY(groupPTY)
+					}
+				case err := <-overlapReady:
+					if running == 0 {
+						// The new instance already exited, the old instance
+						// keeps running.
+						break
+					}
+					if err != nil {
+						wgoCmd.message("-overlap: " + err.Error() + ", keeping the old instance")
+						if stopRunning() {
+							wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+						}
+						for k := range exited {
+							exited[k] = true
+						}
+						cmdResults = nil
+						break
+					}
+					if stopPrevious() {
+						wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+					}
+					stopPrevious = nil
+					wgoCmd.cmdsRunning = true
+					wgoCmd.ready()
+				case err := <-readyURL:
+					if running == 0 {
+						break
+					}
+					if err != nil {
+						wgoCmd.message("-ready-url: " + err.Error() + ", restart failed")
+						countFailure()
+						wgoCmd.showFailure(fmt.Errorf("-ready-url: %w", err))
+						wgoCmd.runHooks("on-error", wgoCmd.OnError)
+						break
+					}
+					wgoCmd.ready()
+				case sig := <-forwarded:
+					for k, cmd := range cmds {
+						if !exited[k] {
+							_ = signalGroup(cmd, sig)
+						}
+					}
+				case fn := <-wgoCmd.calls:
+					fn()
+				case c := <-wgoCmd.controls:
+					switch c {
+					case controlRestart:
+						timer.Stop()
+						if stopRunning() {
+							wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+						}
+						break CMD_CHAIN
+					case controlTogglePause, controlPause, controlResume:
+						if (c == controlPause && wgoCmd.paused) || (c == controlResume && !wgoCmd.paused) {
+							continue
+						}
+						wgoCmd.paused = !wgoCmd.paused
+						if wgoCmd.paused {
+							timer.Stop()
+							wgoCmd.message("paused, file events are ignored")
+						} else {
+							wgoCmd.message("resumed")
+						}
+					case controlStop:
+						timer.Stop()
+						if stopRunning() {
+							wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+						}
+						if stopPrevious != nil && stopPrevious() {
+							wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+						}
+						stopPrevious = nil
+						// Discard the results of the stopped commands so that
+						// they don't carry on the chain.
+						for k := range exited {
+							exited[k] = true
+						}
+						cmdResults = nil
+					case controlRunOnce:
+						isRunning := false
+						for k := range exited {
+							if !exited[k] {
+								isRunning = true
+								break
+							}
+						}
+						if isRunning {
+							continue
+						}
+						timer.Stop()
+						break CMD_CHAIN
+					case controlRollback:
+						if !wgoCmd.isRun || buildIndex == 0 {
+							wgoCmd.message("rollback: no previous build to roll back to")
+							continue
+						}
+						buildIndex--
+						rollbackBinPath = builds[buildIndex]
+						wgoCmd.message(fmt.Sprintf("rolling back to build %d of %d", buildIndex+1, len(builds)))
+						timer.Stop()
+						if stopRunning() {
+							wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+						}
+						if stopPrevious != nil && stopPrevious() {
+							wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+						}
+						stopPrevious = nil
+						break CMD_CHAIN
+					case controlClear:
+						clearScreen(wgoCmd.Stdout)
+					case controlQuit:
+						if stopRunning() {
+							wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+						}
+						return nil
+					}
+				case err := <-watcher.Errors:
+					wgoCmd.Logger.Println(err)
+				case event := <-fileEvents:
+					if wgoCmd.Sync != "" && wgoCmd.isRemoved(event, files) {
+						changedFiles[event.Name] = struct{}{}
+					}
+					if !wgoCmd.matchEvent(watcher, event, files, generated) {
+						continue
+					}
+					wgoCmd.trigger(event.Name)
+					wgoCmd.emit(lifecycleEvent{Event: "change", Op: event.Op.String(), File: event.Name})
+					if wgoCmd.OnFileEvent != nil {
+						wgoCmd.OnFileEvent(event)
+					}
+					if wgoCmd.Generate && files == nil {
+						changedDirs[filepath.Dir(event.Name)] = struct{}{}
+					}
+					if wgoCmd.Sync != "" {
+						changedFiles[event.Name] = struct{}{}
+					}
+					timer.Reset(wgoCmd.Debounce) // Start the timer.
+					wgoCmd.trace("debounce", "reset, restarting in", wgoCmd.Debounce)
+				case <-timer.C: // Timer expired, reload commands.
+					wgoCmd.trace("debounce", "expired")
+					// Don't tear down the running commands for a change that
+					// doesn't pass the gates.
+					if len(wgoCmd.Gates) > 0 {
+						if wgoCmd.output != nil {
+							wgoCmd.output.Reset()
+						}
+						err := wgoCmd.runGates()
+						if wgoCmd.ctx.Err() != nil {
+							break
+						}
+						if err != nil {
+							if running > 0 {
+								wgoCmd.message(err.Error() + ", keeping the running commands")
+							} else {
+								wgoCmd.message(err.Error() + ", not restarting")
+							}
+							wgoCmd.gateFailures++
+							wgoCmd.showFailure(err)
+							wgoCmd.runHooks("on-error", wgoCmd.OnError)
+							break
+						}
+					}
+					// In overlap mode, keep the last command running until
+					// its new instance is ready (unless an old instance is
+					// already being kept running). With KeepRunning, keep it
+					// running until its new instance is about to start.
+					if (wgoCmd.Overlap || wgoCmd.KeepRunning) && isLast && running > 0 && stopPrevious == nil {
+						stopPrevious = stopRunning
+						previousBinPath = currentBinPath
+						break CMD_CHAIN
+					}
+					if stopRunning() {
+						wgoCmd.runHooks("on-stop", wgoCmd.OnStop)
+					}
+					break CMD_CHAIN
+				}
+			}
+		}
+		wgoCmd.endGroup()
+	}
+}
+
+// buildFailedError returns the BuildFailedError of the i-th command, with the
+// recent output of the commands (if it is kept).
+func (wgoCmd *WgoCmd) buildFailedError(i int, err error) *BuildFailedError {
+	failure := &BuildFailedError{Args: wgoCmd.ArgsList[i], Err: err, dir: wgoCmd.dir(i)}
+	if wgoCmd.output != nil {
+		failure.Output = wgoCmd.output.String()
+	}
+	return failure
+}
+
+// startGroup starts a ::group:: of the GitHub Actions log for the commands
+// ArgsList[i] to ArgsList[j], ending the previous group if there is one.
+func (wgoCmd *WgoCmd) startGroup(i, j int) {
+	wgoCmd.endGroup()
+	var b strings.Builder
+	for k := i; k <= j; k++ {
+		if k > i {
+			b.WriteString(" " + wgoCmd.separator(k-1) + " ")
+		}
+		b.WriteString(joinArgs(wgoCmd.maskArgs(wgoCmd.ArgsList[k])))
+	}
+	_, _ = io.WriteString(wgoCmd.Stdout, "::group::"+escapeWorkflowData(b.String())+"\n")
+	wgoCmd.inGroup = true
+}
+
+// endGroup ends the current ::group:: of the GitHub Actions log, if any.
+func (wgoCmd *WgoCmd) endGroup() {
+	if !wgoCmd.inGroup {
+		return
+	}
+	_, _ = io.WriteString(wgoCmd.Stdout, "::endgroup::\n")
+	wgoCmd.inGroup = false
+}
+
+// systemdListenFiles returns the sockets passed to wgo by systemd socket
+// activation (see sd_listen_fds(3)), if any. The LISTEN_* environment
+// variables are unset so that they are not inherited by the commands.
+func systemdListenFiles() []*os.File {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	files := make([]*os.File, n)
+	for i := range files {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		// The first passed file descriptor is always 3. Only the last command
+		// gets the sockets (through ExtraFiles), the other commands, hooks
+		// and filters must not inherit them.
+		closeOnExec(uintptr(3 + i))
+		files[i] = os.NewFile(uintptr(3+i), name)
+	}
+	return files
+}
+
+// waitOverlapReady waits for the new instance of the last command to be ready
+// in overlap mode.
+func (wgoCmd *WgoCmd) waitOverlapReady() error {
+	timeout := wgoCmd.OverlapTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(wgoCmd.ctx, timeout)
+	defer cancel()
+	target := wgoCmd.OverlapProbe
+	if target == "" {
+		target = wgoCmd.ReadyURL
+	}
+	if target == "" {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	}
+	err := waitForProbe(ctx, target)
+	if err != nil {
+		return fmt.Errorf("%s was not ready after %s", target, timeout)
+	}
+	return nil
+}
+
+// waitDependency waits until target (from Waits) responds.
+func (wgoCmd *WgoCmd) waitDependency(target string) error {
+	timeout := wgoCmd.ReadyTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(wgoCmd.ctx, timeout)
+	defer cancel()
+	wgoCmd.Logger.Println("WAITING", target)
+	err := waitForProbe(ctx, target)
+	if err != nil {
+		return fmt.Errorf("%s was not ready after %s", target, timeout)
+	}
+	return nil
+}
+
+// waitReady waits until ReadyURL responds.
+func (wgoCmd *WgoCmd) waitReady() error {
+	timeout := wgoCmd.ReadyTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(wgoCmd.ctx, timeout)
+	defer cancel()
+	err := waitForProbe(ctx, wgoCmd.ReadyURL)
+	if err != nil {
+		return fmt.Errorf("%s was not ready after %s", wgoCmd.ReadyURL, timeout)
+	}
+	return nil
+}
+
+// problemMarker prints one of the markers of FailureFormat vscode that a
+// background problem matcher uses to tell when a build begins and ends:
+// "BUILD START", "BUILD OK" or "BUILD FAILED: <error>". The markers are
+// printed even with Quiet, and never colored.
+func (wgoCmd *WgoCmd) problemMarker(marker string) {
+	if wgoCmd.FailureFormat != "vscode" {
+		return
+	}
+	_, _ = io.WriteString(wgoCmd.Stderr, logPrefix(wgoCmd.Name, 0)+marker+"\n")
+}
+
+// ready reports that the last command is ready.
+func (wgoCmd *WgoCmd) ready() {
+	wgoCmd.Logger.Println("READY")
+	wgoCmd.readies++
+	wgoCmd.readyTime += time.Since(wgoCmd.cycleStart)
+	if wgoCmd.pane != nil {
+		wgoCmd.pane.setStatus("running")
+	}
+	wgoCmd.emit(lifecycleEvent{Event: "ready"})
+	wgoCmd.problemMarker("BUILD OK")
+	if wgoCmd.ReadyURL != "" {
+		wgoCmd.message("ready")
+	}
+	if wgoCmd.Summary {
+		wgoCmd.message(wgoCmd.summary(time.Now()))
+		wgoCmd.triggers = wgoCmd.triggers[:0]
+	}
+	wgoCmd.notify("READY=1")
+	if wgoCmd.proxy != nil {
+		wgoCmd.proxy.release(nil)
+	}
+	if wgoCmd.reloader != nil {
+		wgoCmd.reloader.reload()
+	}
+	if wgoCmd.webhook != nil {
+		wgoCmd.webhook.send(webhookEvent{Event: "success", Text: "wgo: ready"})
+	}
+	if wgoCmd.OnAfterRestart != nil {
+		wgoCmd.OnAfterRestart()
+	}
+	if wgoCmd.failing {
+		wgoCmd.failing = false
+		if wgoCmd.DesktopNotify {
+			go wgoCmd.desktopNotify("wgo: fixed", "The commands are ready again.")
+		}
+	}
+	if wgoCmd.Open != "" && !wgoCmd.opened {
+		wgoCmd.opened = true
+		go wgoCmd.openBrowser()
+	}
+}
+
+// emit sends the event to the -events stream, if there is one.
+func (wgoCmd *WgoCmd) emit(event lifecycleEvent) {
+	if wgoCmd.events == nil {
+		return
+	}
+	event.Name = wgoCmd.Name
+	wgoCmd.events.send(event)
+}
+
+// maxTriggers is how many of the files that triggered a restart are named in
+// the summary.
+const maxTriggers = 3
+
+// trigger records that the file at path triggered the next restart, for
+// Summary.
+func (wgoCmd *WgoCmd) trigger(path string) {
+	if !wgoCmd.Summary {
+		return
+	}
+	file, _ := wgoCmd.normalizePath(path)
+	for _, trigger := range wgoCmd.triggers {
+		if trigger == file {
+			return
+		}
+	}
+	wgoCmd.triggers = append(wgoCmd.triggers, file)
+}
+
+// summary returns the summary of the latest (re)start of the chain, as of now,
+// such as "restarted in 2.431s: build 2.102s, ready 0.329s (main.go changed)".
+func (wgoCmd *WgoCmd) summary(now time.Time) string {
+	formatDuration := func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	}
+	verb := "restarted"
+	if wgoCmd.runs <= 1 {
+		verb = "started"
+	}
+	msg := verb + " in " + formatDuration(now.Sub(wgoCmd.cycleStart))
+	if len(wgoCmd.ArgsList) > 1 {
+		before := "build"
+		if !wgoCmd.isRun {
+			before = "preceding commands"
+		}
+		msg += ": " + before + " " + formatDuration(wgoCmd.lastStart.Sub(wgoCmd.cycleStart)) +
+			", ready " + formatDuration(now.Sub(wgoCmd.lastStart))
+	}
+	if len(wgoCmd.triggers) > 0 {
+		files := wgoCmd.triggers
+		if len(files) > maxTriggers {
+			files = files[:maxTriggers]
+		}
+		msg += " (" + strings.Join(files, ", ")
+		if n := len(wgoCmd.triggers) - len(files); n > 0 {
+			msg += fmt.Sprintf(" and %d more", n)
+		}
+		msg += " changed)"
+	}
+	return msg
+}
+
+// showFailure reports that the build (or a gate) failed with err. The error
+// and the recent output of the commands are shown in the browser, as the page
+// served by the proxy (if it was waiting for the commands) and as an overlay
+// over the pages connected to the livereload server. It is also posted to the
+// webhooks and, with DesktopNotify or Bell, shown as a desktop notification or
+// announced with the terminal bell. It is kept for the last-error command of
+// the control socket and passed to OnBuildFailure.
+func (wgoCmd *WgoCmd) showFailure(err error) {
+	wgoCmd.Logger.Println("FAILED", err)
+	wgoCmd.failing = true
+	if wgoCmd.pane != nil {
+		wgoCmd.pane.setStatus("failed")
+	}
+	wgoCmd.emit(lifecycleEvent{Event: "failed", Error: err.Error()})
+	wgoCmd.problemMarker("BUILD FAILED: " + err.Error())
+	if wgoCmd.Bell {
+		fmt.Fprint(wgoCmd.Stderr, "\a")
+	}
+	if wgoCmd.DesktopNotify {
+		go wgoCmd.desktopNotify("wgo: failed", err.Error())
+	}
+	failure := &buildFailure{Title: err.Error()}
+	if wgoCmd.output != nil {
+		failure.Output = wgoCmd.output.String()
+	}
+	wgoCmd.lastFailure = failure
+	wgoCmd.lastFailureTime = time.Now()
+	if wgoCmd.OnBuildFailure != nil {
+		wgoCmd.OnBuildFailure(err, failure.Output)
+	}
+	if wgoCmd.output == nil {
+		return
+	}
+	if wgoCmd.FailureFormat == "github" {
+		// The file names in the output are relative to the directory of
+		// the command that failed, which may have its own -cd.
+		dir := wgoCmd.Dir
+		var buildErr *BuildFailedError
+		if errors.As(err, &buildErr) {
+			dir = buildErr.dir
+		}
+		_, _ = io.WriteString(wgoCmd.Stdout, githubAnnotations(failure.Output, dir, failure.Title))
+	}
+	if wgoCmd.webhook != nil {
+		wgoCmd.webhook.send(webhookEvent{Event: "failure", Text: "wgo: " + failure.Title, Error: failure.Title, Output: failure.Output})
+	}
+	if wgoCmd.proxy != nil {
+		wgoCmd.proxy.release(failure)
+	}
+	if wgoCmd.reloader != nil {
+		wgoCmd.reloader.fail(failure)
+	}
+}
+
+// desktopNotify shows a desktop notification. Notifications are a nicety, so
+// failing to show one is only logged.
+func (wgoCmd *WgoCmd) desktopNotify(title, message string) {
+	args := notificationCommand(runtime.GOOS, title, message)
+	err := exec.Command(args[0], args[1:]...).Run()
+	if err != nil {
+		wgoCmd.Logger.Println("-notify:", err)
+	}
+}
+
+// notificationCommand returns the command that shows a desktop notification
+// on goos.
+func notificationCommand(goos, title, message string) []string {
+	switch goos {
+	case "darwin":
+		quote := func(s string) string {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+		}
+		return []string{"osascript", "-e", "display notification " + quote(message) + " with title " + quote(title)}
+	case "windows":
+		quote := func(s string) string {
+			return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+		}
+		script := "[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null; " +
+			"$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02); " +
+			"$text = $template.GetElementsByTagName('text'); " +
+			"$text.Item(0).AppendChild($template.CreateTextNode(" + quote(title) + ")) > $null; " +
+			"$text.Item(1).AppendChild($template.CreateTextNode(" + quote(message) + ")) > $null; " +
+			"[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('wgo').Show([Windows.UI.Notifications.ToastNotification]::new($template))"
+		// The toast API is only available in Windows PowerShell, not pwsh.
+		return []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script}
+	default:
+		return []string{"notify-send", "--app-name=wgo", title, message}
+	}
+}
+
+// openBrowser opens Open in the default browser, once HealthURL responds (if
+// it is set).
+func (wgoCmd *WgoCmd) openBrowser() {
+	if wgoCmd.HealthURL != "" {
+		ctx, cancel := context.WithTimeout(wgoCmd.ctx, 30*time.Second)
+		defer cancel()
+		err := waitForProbe(ctx, wgoCmd.HealthURL)
+		if err != nil {
+			wgoCmd.message("-open: " + wgoCmd.HealthURL + " is not healthy, not opening " + wgoCmd.Open)
+			return
+		}
+	}
+	args := browserCommand(runtime.GOOS, wgoCmd.Open)
+	wgoCmd.Logger.Println("OPEN", wgoCmd.Open)
+	err := exec.Command(args[0], args[1:]...).Run()
+	if err != nil {
+		wgoCmd.message("-open: " + err.Error())
+	}
+}
+
+// browserCommand returns the command that opens url in the default browser on
+// goos.
+func browserCommand(goos, url string) []string {
+	switch goos {
+	case "darwin":
+		return []string{"open", url}
+	case "windows":
+		return []string{"rundll32", "url.dll,FileProtocolHandler", url}
+	default:
+		return []string{"xdg-open", url}
+	}
+}
+
+// waitPortsFree waits until every address in WaitPorts can be listened on.
+func (wgoCmd *WgoCmd) waitPortsFree() error {
+	ctx, cancel := context.WithTimeout(wgoCmd.ctx, 10*time.Second)
+	defer cancel()
+	for _, address := range wgoCmd.WaitPorts {
+		for {
+			ln, err := net.Listen("tcp", address)
+			if err == nil {
+				ln.Close()
+				break
+			}
+			select {
+			case <-ctx.Done():
+				if wgoCmd.ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("%s is still in use after 10s", address)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	return nil
+}
+
+// waitStopped waits for the commands that were asked to stop to exit (which
+// is signalled by waitDone), and kills them if they take longer than
+// KillTimeout. If dump is not nil, the last command is sent SIGQUIT first and
+// its goroutine dump is saved to DumpFile.
+func (wgoCmd *WgoCmd) waitStopped(cmds []*exec.Cmd, dump *dumpWriter, waitDone <-chan struct{}) {
+	timeout := wgoCmd.KillTimeout
+	if timeout == 0 && wgoCmd.DumpFile != "" {
+		timeout = 10 * time.Second
+	}
+	if timeout == 0 {
+		return
+	}
+	select {
+	case <-waitDone:
+		return
+	case <-time.After(timeout):
+	}
+	if dump != nil {
+		err := wgoCmd.dumpGoroutines(cmds[len(cmds)-1], dump, waitDone)
+		if err != nil {
+			wgoCmd.message("-dump-on-hang: " + err.Error())
+		} else {
+			wgoCmd.message("the last command did not exit within " + timeout.String() + ", its goroutine dump was written to " + wgoCmd.DumpFile)
+		}
+	}
+	select {
+	case <-waitDone:
+		return
+	default:
+	}
+	wgoCmd.message("killing commands that did not exit within " + timeout.String())
+	for _, cmd := range cmds {
+		kill(cmd)
+	}
+}
+
+// dumpGoroutines sends SIGQUIT to the command and saves its stderr to
+// DumpFile until it exits, or until 5 seconds have passed.
+func (wgoCmd *WgoCmd) dumpGoroutines(cmd *exec.Cmd, dump *dumpWriter, waitDone <-chan struct{}) error {
+	file, err := os.Create(wgoCmd.DumpFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	dump.record(file)
+	defer dump.record(nil)
+	err = quit(cmd)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-waitDone:
+	case <-time.After(5 * time.Second):
+	}
+	return nil
+}
+
+// dumpWriter writes to w, and also copies everything to file while file is
+// not nil.
+type dumpWriter struct {
+	w    io.Writer
+	mu   sync.Mutex
+	file io.Writer
+}
+
+func (dump *dumpWriter) Write(p []byte) (n int, err error) {
+	dump.mu.Lock()
+	if dump.file != nil {
+		_, _ = dump.file.Write(p)
+	}
+	dump.mu.Unlock()
+	return dump.w.Write(p)
+}
+
+// record starts copying everything written to file, or stops copying if file
+// is nil.
+func (dump *dumpWriter) record(file io.Writer) {
+	dump.mu.Lock()
+	defer dump.mu.Unlock()
+	dump.file = file
+}
+
+// checkHealth probes HealthURL until done is closed, and sends an error to
+// restart once it has failed HealthRetries times in a row.
+func (wgoCmd *WgoCmd) checkHealth(done <-chan struct{}, restart chan<- error) {
+	interval := wgoCmd.HealthInterval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	retries := wgoCmd.HealthRetries
+	if retries == 0 {
+		retries = 3
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-wgoCmd.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := probe(wgoCmd.ctx, wgoCmd.HealthURL)
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		wgoCmd.Logger.Println("HEALTH", err)
+		if failures >= retries {
+			restart <- fmt.Errorf("-health: %s failed %d times in a row", wgoCmd.HealthURL, failures)
+			return
+		}
+	}
+}
+
+// reportStats logs the CPU and memory usage of the process with the given pid
+// (and its child processes) every StatsInterval until done is closed.
+func (wgoCmd *WgoCmd) reportStats(pid int, done <-chan struct{}) {
+	ticker := time.NewTicker(wgoCmd.StatsInterval)
+	defer ticker.Stop()
+	lastTime := time.Now()
+	var lastCPU time.Duration
+	for {
+		select {
+		case <-done:
+			return
+		case <-wgoCmd.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		memory, cpu, err := processUsage(pid)
+		if err != nil {
+			wgoCmd.Logger.Println("-stats:", err)
+			continue
+		}
+		now := time.Now()
+		// The CPU time of child processes that have exited is no longer
+		// counted, so the total can go down.
+		var percent float64
+		if cpu > lastCPU {
+			percent = 100 * float64(cpu-lastCPU) / float64(now.Sub(lastTime))
+		}
+		lastTime, lastCPU = now, cpu
+		wgoCmd.message(fmt.Sprintf("cpu %.1f%% mem %s", percent, formatSize(memory)))
+	}
+}
+
+// checkMemory checks the memory usage of the process with the given pid (and
+// its child processes) until done is closed, and sends an error to restart
+// once it exceeds MaxMemory.
+func (wgoCmd *WgoCmd) checkMemory(pid int, done <-chan struct{}, restart chan<- error) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-wgoCmd.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		memory, _, err := processUsage(pid)
+		if err != nil {
+			wgoCmd.Logger.Println("-max-mem:", err)
+			continue
+		}
+		if memory > wgoCmd.MaxMemory {
+			restart <- fmt.Errorf("-max-mem: the last command is using %s (limit %s)", formatSize(memory), formatSize(wgoCmd.MaxMemory))
+			return
+		}
+	}
+}
+
+// processUsage returns the memory usage in bytes and the CPU time used so far
+// of the process with the given pid and all its child processes.
+func processUsage(pid int) (memory uint64, cpu time.Duration, err error) {
+	parents, memoryByPID, cpuByPID, err := processList()
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, ok := parents[pid]; !ok {
+		return 0, 0, fmt.Errorf("process %d not found", pid)
+	}
+	for _, p := range processTree(pid, parents) {
+		memory += memoryByPID[p]
+		cpu += cpuByPID[p]
+	}
+	return memory, cpu, nil
+}
+
+// processTree returns pid and the pids of all its descendants, given a map of
+// every pid to its parent pid.
+func processTree(pid int, parents map[int]int) []int {
+	children := make(map[int][]int)
+	for child, parent := range parents {
+		children[parent] = append(children[parent], child)
+	}
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree
+}
+
+// rlimitNames maps the resource names accepted by -rlimit to the option of
+// the ulimit shell builtin that sets them, and whether the limit is a size
+// (which ulimit takes in kilobytes).
+var rlimitNames = map[string]struct {
+	option string
+	size   bool
+}{
+	"nofile": {"-n", false}, // RLIMIT_NOFILE, the number of open files.
+	"as":     {"-v", true},  // RLIMIT_AS, virtual memory.
+	"data":   {"-d", true},  // RLIMIT_DATA, the data segment.
+	"stack":  {"-s", true},  // RLIMIT_STACK, the stack.
+	"cpu":    {"-t", false}, // RLIMIT_CPU, CPU time in seconds.
+}
+
+// parseRlimit parses a NAME=VALUE resource limit and returns the ulimit option
+// and value that set it. VALUE is a number, a size like 2GB for the size
+// limits, or "unlimited".
+func parseRlimit(value string) (option, limit string, err error) {
+	i := strings.Index(value, "=")
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid resource limit %q, expected NAME=VALUE", value)
+	}
+	name, limit := strings.ToLower(value[:i]), value[i+1:]
+	rlimit, ok := rlimitNames[name]
+	if !ok {
+		names := make([]string, 0, len(rlimitNames))
+		for name := range rlimitNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", "", fmt.Errorf("unknown resource %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	if limit == "unlimited" {
+		return rlimit.option, limit, nil
+	}
+	if rlimit.size {
+		size, err := parseSize(limit)
+		if err != nil {
+			return "", "", err
+		}
+		return rlimit.option, strconv.FormatUint((size+1023)/1024, 10), nil
+	}
+	_, err = strconv.ParseUint(limit, 10, 64)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid limit %q for %s", limit, name)
+	}
+	return rlimit.option, limit, nil
+}
+
+// parseSize parses a size in bytes like 512, 64KB, 500MB or 2GB. The units are
+// powers of 1024 and are case insensitive.
+func parseSize(value string) (uint64, error) {
+	units := []struct {
+		suffix string
+		size   uint64
+	}{
+		{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+		{"b", 1},
+	}
+	number, multiplier := strings.ToLower(strings.TrimSpace(value)), uint64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return uint64(n * float64(multiplier)), nil
+}
+
+// formatSize formats a size in bytes for humans.
+func formatSize(size uint64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
+
+// probe checks whether the target is up. The target is either an http:// or
+// https:// URL, which must respond with a 2xx status code, or a TCP address
+// (optionally prefixed with tcp://), which must accept connections.
+func probe(ctx context.Context, target string) error {
+	// Don't let a target that accepts connections but never responds hang
+	// the caller.
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s: %s", target, resp.Status)
+		}
+		return nil
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", strings.TrimPrefix(target, "tcp://"))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// waitForProbe probes the target repeatedly until it is up or the context is
+// done.
+func waitForProbe(ctx context.Context, target string) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		err := probe(ctx, target)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// notify sends a state change such as "READY=1" to systemd, if wgo was
+// started by systemd with Type=notify. See sd_notify(3).
+func (wgoCmd *WgoCmd) notify(state string) {
+	if wgoCmd.notifySocket == "" {
+		return
+	}
+	conn, err := net.Dial("unixgram", wgoCmd.notifySocket)
+	if err != nil {
+		wgoCmd.Logger.Println("sd_notify:", err)
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		wgoCmd.Logger.Println("sd_notify:", err)
+	}
+}
+
+// command prepares an *exec.Cmd for the given args. If the command cannot be
+// found in PATH, it is wrapped in a shell instead.
+//
+// We are not using exec.CommandContext() because it uses cmd.Process.Kill() to
+// kill the process, but we want to use our custom stop() function to kill the
+// process. Our stop() function is better than cmd.Process.Kill() because it
+// kills the child processes as well.
+func (wgoCmd *WgoCmd) command(args []string) (*exec.Cmd, error) {
+	cmd := &exec.Cmd{
+		Path:   args[0],
+		Args:   args,
+		Env:    wgoCmd.env,
+		Dir:    wgoCmd.Dir,
+		Stdout: wgoCmd.Stdout,
+		Stderr: wgoCmd.Stderr,
+	}
+	setpgid(cmd)
+	if filepath.Base(cmd.Path) == cmd.Path {
+		var err error
+		cmd.Path, err = exec.LookPath(cmd.Path)
+		if errors.Is(err, exec.ErrNotFound) {
+			return wgoCmd.shellCommand(joinArgs(args))
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+// cleanEnv lists the environment variables that are still passed to the
+// commands with CleanEnv, because many programs (including the go command)
+// don't work without them.
+var cleanEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "TMPDIR", "LANG"}
+
+// cleanEnvWindows is the equivalent of cleanEnv on Windows.
+var cleanEnvWindows = []string{
+	"PATH", "PATHEXT", "SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "TEMP", "TMP",
+	"USERPROFILE", "APPDATA", "LOCALAPPDATA", "PROGRAMDATA", "USERNAME",
+}
+
+// environ returns the environment of the commands. If it returns nil, the
+// commands inherit wgo's environment.
+func (wgoCmd *WgoCmd) environ() ([]string, error) {
+	if !wgoCmd.CleanEnv && len(wgoCmd.EnvFiles) == 0 && len(wgoCmd.EnvCmds) == 0 && len(wgoCmd.Env) == 0 {
+		return nil, nil
+	}
+	var env []string
+	if wgoCmd.CleanEnv {
+		names := cleanEnv
+		if runtime.GOOS == "windows" {
+			names = cleanEnvWindows
+		}
+		env = []string{}
+		for _, name := range append(names[:len(names):len(names)], wgoCmd.PassEnv...) {
+			if value, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+value)
+			}
+		}
+	} else {
+		env = os.Environ()
+	}
+	// os/exec keeps the last value of duplicate keys.
+	for _, name := range wgoCmd.EnvFiles {
+		vars, err := readEnvFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("-env-file: %w", err)
+		}
+		env = append(env, vars...)
+	}
+	for _, script := range wgoCmd.EnvCmds {
+		vars, err := wgoCmd.runEnvCmd(script)
+		if err != nil {
+			return nil, fmt.Errorf("-env-cmd %q: %w", script, err)
+		}
+		env = append(env, vars...)
+	}
+	return append(env, wgoCmd.Env...), nil
+}
+
+// expandArgs returns a copy of args with $VAR and ${VAR} references replaced
+// by the values of the environment variables of the commands.
+func (wgoCmd *WgoCmd) expandArgs(args []string) []string {
+	env := wgoCmd.env
+	if env == nil {
+		env = os.Environ()
+	}
+	values := make(map[string]string)
+	for _, entry := range env {
+		i := strings.Index(entry, "=")
+		if i <= 0 {
+			continue
+		}
+		key := entry[:i]
+		if runtime.GOOS == "windows" {
+			key = strings.ToUpper(key)
+		}
+		values[key] = entry[i+1:]
+	}
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = os.Expand(arg, func(name string) string {
+			if name == "$" {
+				return "$"
+			}
+			if runtime.GOOS == "windows" {
+				name = strings.ToUpper(name)
+			}
+			return values[name]
+		})
+	}
+	return expanded
+}
+
+// versionLdflags returns the -X flags for AutoLdflags. The git flags are left
+// out if the main package is not in a git repository.
+func (wgoCmd *WgoCmd) versionLdflags() string {
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = wgoCmd.dir(0)
+		output, err := cmd.Output()
+		return strings.TrimSpace(string(output)), err
+	}
+	flags := "-X main.buildTime=" + time.Now().UTC().Format(time.RFC3339)
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		wgoCmd.Logger.Println("-auto-ldflags: git rev-parse HEAD:", err)
+		return flags
+	}
+	flags += " -X main.commit=" + commit
+	branch, err := git("rev-parse", "--abbrev-ref", "HEAD")
+	if err == nil {
+		flags += " -X main.branch=" + branch
+	}
+	status, err := git("status", "--porcelain")
+	if err == nil {
+		flags += " -X main.dirty=" + strconv.FormatBool(status != "")
+	}
+	return flags
+}
+
+// shellQuote joins the words into a string that can be evaluated by a POSIX
+// shell such as sh, regardless of the OS that wgo is running on. Every word is
+// single-quoted.
+func shellQuote(word string, words ...string) string {
+	var b strings.Builder
+	for i, word := range append([]string{word}, words...) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString("'" + strings.ReplaceAll(word, "'", `'\''`) + "'")
+	}
+	return b.String()
+}
+
+// goCommand returns the go command to run, which is Go if set.
+func (wgoCmd *WgoCmd) goCommand() string {
+	if wgoCmd.Go != "" {
+		return wgoCmd.Go
+	}
+	return "go"
+}
+
+// sameBinary reports whether two Go binaries are identical apart from their
+// build IDs. The build ID ends with the content ID of the binary, which is
+// computed over the binary with the build ID left out, so two binaries are
+// identical if their content IDs are equal. It reports false if the build ID
+// of either binary can't be read.
+func sameBinary(goCommand, name1, name2 string) bool {
+	var contentIDs [2]string
+	for i, name := range []string{name1, name2} {
+		output, err := exec.Command(goCommand, "tool", "buildid", name).Output()
+		if err != nil {
+			return false
+		}
+		buildID := strings.TrimSpace(string(output))
+		contentIDs[i] = buildID[strings.LastIndex(buildID, "/")+1:]
+	}
+	return contentIDs[0] != "" && contentIDs[0] == contentIDs[1]
+}
+
+// goPackages describes the packages that the main package of `wgo run`
+// depends on (including itself), excluding the standard library.
+type goPackages struct {
+	dirs    map[string]struct{} // The directories of the packages.
+	embeds  []embedPattern      // The //go:embed patterns of the packages.
+	ignored map[string]struct{} // The .go files excluded by build constraints.
+}
+
+// embedPattern is a //go:embed pattern of the package in dir.
+type embedPattern struct {
+	dir     string
+	pattern string
+}
+
+// listPackages returns the packages that the main package of `wgo run`
+// depends on, according to `go list -deps`.
+func (wgoCmd *WgoCmd) listPackages() (*goPackages, error) {
+	// ArgsList[0] is `go build [-C=dir] -o binPath [GO_BUILD_FLAGS]
+	// <package>`.
+	// Each package is printed as a "P dir" line, followed by an "E pattern"
+	// line for each //go:embed pattern and an "I file" line for each file
+	// excluded by build constraints.
+	format := "{{if not .Standard}}P {{.Dir}}\n" +
+		"{{range .EmbedPatterns}}E {{.}}\n{{end}}" +
+		"{{range .IgnoredGoFiles}}I {{.}}\n{{end}}{{end}}"
+	args := []string{wgoCmd.goCommand(), "list"}
+	buildArgs := wgoCmd.ArgsList[0][2:]
+	if buildArgs[0] != "-o" {
+		args = append(args, buildArgs[0])
+		buildArgs = buildArgs[1:]
+	}
+	args = append(args, "-e", "-deps", "-f", format)
+	args = append(args, buildArgs[2:]...)
+	cmd, err := wgoCmd.command(args)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Dir = wgoCmd.dir(0)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		if stderr.Len() > 0 {
+			return nil, fmt.Errorf("%s", strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+	packages := &goPackages{
+		dirs:    make(map[string]struct{}),
+		ignored: make(map[string]struct{}),
+	}
+	var dir string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) < 2 {
+			continue
+		}
+		switch line[:2] {
+		case "P ":
+			dir = line[2:]
+			packages.dirs[dir] = struct{}{}
+		case "E ":
+			packages.embeds = append(packages.embeds, embedPattern{
+				dir:     dir,
+				pattern: strings.TrimPrefix(line[2:], "all:"),
+			})
+		case "I ":
+			packages.ignored[filepath.Join(dir, line[2:])] = struct{}{}
+		}
+	}
+	return packages, nil
+}
+
+// buildContext returns the build.Context that the package of `wgo run` is
+// built with: the GOOS, GOARCH and CGO_ENABLED of the environment of the
+// commands and the -tags of the go build flags.
+func (wgoCmd *WgoCmd) buildContext() build.Context {
+	buildContext := build.Default
+	for _, entry := range wgoCmd.env {
+		i := strings.Index(entry, "=")
+		if i <= 0 {
+			continue
+		}
+		switch key, value := entry[:i], entry[i+1:]; key {
+		case "GOOS":
+			buildContext.GOOS = value
+		case "GOARCH":
+			buildContext.GOARCH = value
+		case "CGO_ENABLED":
+			buildContext.CgoEnabled = value == "1"
+		}
+	}
+	// ArgsList[0] is `go build [-C=dir] -o binPath [GO_BUILD_FLAGS]
+	// <package>`, the last -tags wins.
+	buildArgs := wgoCmd.ArgsList[0]
+	for i, arg := range buildArgs {
+		var tags string
+		switch {
+		case (arg == "-tags" || arg == "--tags") && i+1 < len(buildArgs):
+			tags = buildArgs[i+1]
+		case strings.HasPrefix(arg, "-tags="):
+			tags = strings.TrimPrefix(arg, "-tags=")
+		case strings.HasPrefix(arg, "--tags="):
+			tags = strings.TrimPrefix(arg, "--tags=")
+		default:
+			continue
+		}
+		// The tags are separated by commas, or by spaces in older versions
+		// of Go.
+		buildContext.BuildTags = strings.FieldsFunc(tags, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+	return buildContext
+}
+
+// updatePackages refreshes the packages of `wgo run` and returns the
+// directories that need to be watched now but possibly weren't before.
+func (wgoCmd *WgoCmd) updatePackages() []string {
+	packages, err := wgoCmd.listPackages()
+	if err != nil {
+		wgoCmd.Logger.Println("go list:", err)
+		return nil
+	}
+	previous := wgoCmd.packages
+	wgoCmd.packages = packages
+	if previous == nil {
+		return nil
+	}
+	var newDirs []string
+	if wgoCmd.Deps {
+		for dir := range packages.dirs {
+			if _, ok := previous.dirs[dir]; !ok {
+				newDirs = append(newDirs, dir)
+			}
+		}
+	}
+	previousEmbeds := make(map[string]struct{})
+	for _, embed := range previous.embeds {
+		previousEmbeds[embed.base()] = struct{}{}
+	}
+	for _, embed := range packages.embeds {
+		if _, ok := previousEmbeds[embed.base()]; !ok {
+			newDirs = append(newDirs, embed.base())
+		}
+	}
+	sort.Strings(newDirs)
+	return newDirs
+}
+
+// base returns the directory that contains every file matched by the
+// pattern.
+func (embed embedPattern) base() string {
+	elems := strings.Split(embed.pattern, "/")
+	for i, elem := range elems {
+		if strings.ContainsAny(elem, "*?[\\") || i == len(elems)-1 {
+			return filepath.Join(embed.dir, filepath.FromSlash(strings.Join(elems[:i], "/")))
+		}
+	}
+	return embed.dir
+}
+
+// match reports whether the file is embedded by the pattern, either directly
+// or because the pattern matches one of its parent directories.
+func (embed embedPattern) match(file string) bool {
+	rel, err := filepath.Rel(embed.dir, file)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasPrefix(rel, "../") {
+		return false
+	}
+	for i := 0; i <= len(rel); i++ {
+		if i < len(rel) && rel[i] != '/' {
+			continue
+		}
+		if ok, _ := path.Match(embed.pattern, rel[:i]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultMaskRegexp matches the names of environment variables and flags that
+// usually hold secrets.
+var defaultMaskRegexp = regexp.MustCompile(`(?i)token|password|passwd|secret|key`)
+
+// maskArgs returns a copy of args with the secrets replaced by REDACTED, so that
+// the args can be logged. An arg is a secret if it is the value of a
+// NAME=VALUE pair, a -name=value flag or a -name value flag whose name matches
+// MaskRegexps, or if it contains the value of such an environment variable.
+func (wgoCmd *WgoCmd) maskArgs(args []string) []string {
+	maskRegexps := wgoCmd.MaskRegexps
+	if len(maskRegexps) == 0 {
+		maskRegexps = []*regexp.Regexp{defaultMaskRegexp}
+	}
+	isSecret := func(name string) bool {
+		name = strings.TrimLeft(name, "-")
+		for _, r := range maskRegexps {
+			if r.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}
+	env := wgoCmd.env
+	if env == nil {
+		env = os.Environ()
+	}
+	var secrets []string
+	for _, entry := range env {
+		i := strings.Index(entry, "=")
+		// Don't mask short values, they would mask too much.
+		if i > 0 && len(entry)-i-1 >= 4 && isSecret(entry[:i]) {
+			secrets = append(secrets, entry[i+1:])
+		}
+	}
+	masked := make([]string, len(args))
+	for i, arg := range args {
+		if i > 0 && strings.HasPrefix(args[i-1], "-") && !strings.Contains(args[i-1], "=") && isSecret(args[i-1]) && !strings.HasPrefix(arg, "-") {
+			masked[i] = "REDACTED"
+			continue
+		}
+		if j := strings.Index(arg, "="); j > 0 && isSecret(arg[:j]) {
+			masked[i] = arg[:j+1] + "REDACTED"
+			continue
+		}
+		for _, secret := range secrets {
+			arg = strings.ReplaceAll(arg, secret, "REDACTED")
+		}
+		masked[i] = arg
+	}
+	return masked
+}
+
+// runEnvCmd runs the script and parses its output for environment variables.
+func (wgoCmd *WgoCmd) runEnvCmd(script string) ([]string, error) {
+	cmd, err := wgoCmd.shellCommand(script)
+	if err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	waitDone := make(chan error, 1)
+	go func() {
+		waitDone <- cmd.Wait()
+	}()
+	select {
+	case <-wgoCmd.ctx.Done():
+		stop(cmd)
+		<-waitDone
+		return nil, wgoCmd.ctx.Err()
+	case err := <-waitDone:
+		if err != nil {
+			return nil, err
+		}
+	}
+	output := bytes.TrimSpace(stdout.Bytes())
+	if bytes.HasPrefix(output, []byte("{")) {
+		// Numbers are decoded as json.Number so that they are passed on as
+		// they were written, instead of as float64 (which formats 2764800 as
+		// 2.7648e+06).
+		var object map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(output))
+		decoder.UseNumber()
+		err := decoder.Decode(&object)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		vars := make([]string, 0, len(keys))
+		for _, key := range keys {
+			switch value := object[key].(type) {
+			case string:
+				vars = append(vars, key+"="+value)
+			case nil:
+				vars = append(vars, key+"=")
+			case json.Number:
+				vars = append(vars, key+"="+value.String())
+			case bool:
+				vars = append(vars, key+"="+strconv.FormatBool(value))
+			default:
+				b, _ := json.Marshal(value)
+				vars = append(vars, key+"="+string(b))
+			}
+		}
+		return vars, nil
+	}
+	return parseEnv("output", output)
+}
+
+// readEnvFile reads a dotenv file and returns its variables as KEY=VALUE
+// entries. Each line is a KEY=VALUE pair, optionally prefixed with "export".
+// Blank lines and lines starting with # are ignored. Values may be wrapped in
+// single quotes (taken literally) or double quotes (where \n, \t, \" and \\
+// are unescaped), otherwise anything after " #" is a comment.
+func readEnvFile(name string) ([]string, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseEnv(name, b)
+}
+
+// parseEnv parses KEY=VALUE lines in the format described in readEnvFile. The
+// name is used in error messages.
+func parseEnv(name string, b []byte) ([]string, error) {
+	var vars []string
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", name, i+1)
+		}
+		key, value := strings.TrimSpace(line[:eq]), strings.TrimSpace(line[eq+1:])
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && strings.LastIndexByte(value, '\'') > 0:
+			value = value[1:strings.LastIndexByte(value, '\'')]
+		case len(value) >= 2 && value[0] == '"' && strings.LastIndexByte(value, '"') > 0:
+			value = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value[1:strings.LastIndexByte(value, '"')])
+		default:
+			if j := strings.Index(value, " #"); j >= 0 {
+				value = strings.TrimSpace(value[:j])
+			}
+		}
+		vars = append(vars, key+"="+value)
+	}
+	return vars, nil
+}
+
+// shellCommand prepares an *exec.Cmd that evaluates the script using sh (or
+// pwsh.exe if you're on Windows).
+func (wgoCmd *WgoCmd) shellCommand(script string) (*exec.Cmd, error) {
+	args := []string{"sh", "-c", script}
+	if runtime.GOOS == "windows" {
+		args = []string{"pwsh.exe", "-command", script}
+	}
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return nil, err
+	}
+	cmd := &exec.Cmd{
+		Path:   path,
+		Args:   args,
+		Env:    wgoCmd.env,
+		Dir:    wgoCmd.Dir,
+		Stdout: wgoCmd.Stdout,
+		Stderr: wgoCmd.Stderr,
+	}
+	setpgid(cmd)
+	return cmd, nil
+}
+
+// runHooks runs each hook script to completion. Hooks run outside of the
+// command chain, so a failing hook is only logged and never stops the chain.
+func (wgoCmd *WgoCmd) runHooks(name string, hooks []string) {
+	for _, hook := range hooks {
+		cmd, err := wgoCmd.shellCommand(hook)
+		if err == nil {
+			err = cmd.Run()
+		}
+		if err != nil {
+			wgoCmd.Logger.Println(name, "hook:", err)
+		}
+	}
+}
+
+// runGates runs the Gates one after another and returns the error of the
+// first gate that fails.
+func (wgoCmd *WgoCmd) runGates() error {
+	for _, gate := range wgoCmd.Gates {
+		cmd, err := wgoCmd.shellCommand(gate)
+		if err != nil {
+			return fmt.Errorf("-gate %q: %w", gate, err)
+		}
+		wgoCmd.Logger.Println("EXECUTING", wgoCmd.maskArgs([]string{gate})[0])
+		err = cmd.Start()
+		if err != nil {
+			return fmt.Errorf("-gate %q: %w", gate, err)
+		}
+		waitDone := make(chan error, 1)
+		go func() {
+			waitDone <- cmd.Wait()
+		}()
+		select {
+		case <-wgoCmd.ctx.Done():
+			stop(cmd)
+			<-waitDone
+			return wgoCmd.ctx.Err()
+		case err := <-waitDone:
+			if err != nil {
+				return fmt.Errorf("-gate %q failed: %w", gate, err)
+			}
+		}
+	}
+	return nil
+}
+
+// outputFilter is an io.Writer that feeds everything written to it into the
+// stdin of the OutputFilter script.
+type outputFilter struct {
+	wgoCmd *WgoCmd
+	stdout io.Writer
+	stderr io.Writer
+
+	mu       sync.Mutex
+	stdin    io.WriteCloser
+	waitDone chan struct{}
+}
+
+// start starts the OutputFilter script.
+func (filter *outputFilter) start() error {
+	cmd, err := filter.wgoCmd.shellCommand(filter.wgoCmd.OutputFilter)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = filter.stdout
+	cmd.Stderr = filter.stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	waitDone := make(chan struct{})
+	go func() {
+		defer close(waitDone)
+		err := cmd.Wait()
+		filter.wgoCmd.Logger.Println("-output-filter exited:", err)
+	}()
+	filter.stdin = stdin
+	filter.waitDone = waitDone
+	return nil
+}
+
+// Write implements io.Writer. If the OutputFilter script is not running, it
+// is started.
+func (filter *outputFilter) Write(p []byte) (n int, err error) {
+	filter.mu.Lock()
+	defer filter.mu.Unlock()
+	for attempt := 0; attempt < 2; attempt++ {
+		if filter.stdin == nil {
+			err = filter.start()
+			if err != nil {
+				return 0, err
+			}
+		}
+		n, err = filter.stdin.Write(p)
+		if err == nil {
+			return n, nil
+		}
+		// The script has most likely exited. Clean up and try again with a
+		// fresh instance.
+		filter.stdin.Close()
+		<-filter.waitDone
+		filter.stdin = nil
+	}
+	return n, err
+}
+
+// Close closes the stdin of the OutputFilter script and waits for it to exit.
+func (filter *outputFilter) Close() error {
+	filter.mu.Lock()
+	defer filter.mu.Unlock()
+	if filter.stdin == nil {
+		return nil
+	}
+	err := filter.stdin.Close()
+	<-filter.waitDone
+	filter.stdin = nil
+	return err
+}
+
+// readControlKeys reads keypresses from a terminal in cbreak mode and sends
+// the corresponding controls to the event loop.
+func (wgoCmd *WgoCmd) readControlKeys(src io.Reader) {
+	buf := make([]byte, 1)
+	for {
+		_, err := src.Read(buf)
+		if err != nil {
+			return
+		}
+		if c, ok := controlKeys[buf[0]]; ok {
+			if !wgoCmd.sendControl(c) {
+				return
+			}
+		}
+	}
+}
+
+// readControlLines reads lines from src and sends the controls typed on their
+// own line (e.g. ":r") to the event loop. Every other line is written to dst.
+func (wgoCmd *WgoCmd) readControlLines(src io.Reader, dst io.WriteCloser) {
+	defer dst.Close()
+	reader := bufio.NewReader(src)
+	for {
+		line, err := reader.ReadString('\n')
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 2 && trimmed[0] == ':' {
+			if c, ok := controlKeys[trimmed[1]]; ok {
+				if !wgoCmd.sendControl(c) {
+					return
+				}
+				line = ""
+			}
+		}
+		if line != "" {
+			_, werr := io.WriteString(dst, line)
+			if werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handleControl handles the HTTP requests to the Listen address.
+func (wgoCmd *WgoCmd) handleControl(w http.ResponseWriter, r *http.Request) {
+	var c control
+	switch r.URL.Path {
+	case "/restart":
+		c = controlRestart
+	case "/stop":
+		c = controlStop
+	case "/run-once":
+		c = controlRunOnce
+	case "/rollback":
+		c = controlRollback
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !wgoCmd.sendControl(c) {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// serveControlSocket accepts connections on the control socket until it is
+// closed. Each line a client sends is a command, and wgo replies to each
+// command with a single line.
+func (wgoCmd *WgoCmd) serveControlSocket(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				args := strings.Fields(scanner.Text())
+				if len(args) == 0 {
+					continue
+				}
+				_, err := fmt.Fprintln(conn, wgoCmd.controlCommand(args))
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// controlCommand runs a command received on the control socket and returns the
+// reply. The commands are:
+//
+//	restart (or trigger)         restart the commands
+//	stop                         stop the commands until the next file event
+//	run-once                     start the commands if they are not running
+//	rollback                     restart the last command with the previous build (-keep-builds)
+//	pause                        ignore file events
+//	resume                       stop ignoring file events
+//	status                       report the status of wgo as a JSON object
+//	stats                        report the statistics of the session as a JSON object
+//	last-error                   report the most recent failure and its output as a JSON object
+//	file|xfile|dir|xdir [REGEX]  replace the -file/-xfile/-dir/-xdir patterns
+//
+// The reply is "ok" if the command succeeded, or starts with "error: " if it
+// failed.
+func (wgoCmd *WgoCmd) controlCommand(args []string) string {
+	var c control
+	switch args[0] {
+	case "restart", "trigger":
+		c = controlRestart
+	case "stop":
+		c = controlStop
+	case "run-once":
+		c = controlRunOnce
+	case "rollback":
+		c = controlRollback
+	case "pause":
+		c = controlPause
+	case "resume":
+		c = controlResume
+	case "status":
+		var status controlStatus
+		if !wgoCmd.callEventLoop(func() { status = wgoCmd.status() }) {
+			return "error: wgo is exiting"
+		}
+		b, err := json.Marshal(status)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		return string(b)
+	case "stats":
+		var stats controlStats
+		if !wgoCmd.callEventLoop(func() { stats = wgoCmd.stats() }) {
+			return "error: wgo is exiting"
+		}
+		b, err := json.Marshal(stats)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		return string(b)
+	case "last-error":
+		var lastError controlLastError
+		var failed bool
+		if !wgoCmd.callEventLoop(func() { lastError, failed = wgoCmd.lastError() }) {
+			return "error: wgo is exiting"
+		}
+		if !failed {
+			return "error: nothing has failed yet"
+		}
+		b, err := json.Marshal(lastError)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		return string(b)
+	case "file", "xfile", "dir", "xdir":
+		regexps := make([]*regexp.Regexp, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			r, err := compileRegexp(arg)
+			if err != nil {
+				return "error: " + err.Error()
+			}
+			regexps = append(regexps, r)
+		}
+		ok := wgoCmd.callEventLoop(func() {
+			switch args[0] {
+			case "file":
+				wgoCmd.FileRegexps = regexps
+			case "xfile":
+				wgoCmd.ExcludeFileRegexps = regexps
+			case "dir":
+				wgoCmd.DirRegexps = regexps
+			case "xdir":
+				wgoCmd.ExcludeDirRegexps = regexps
+			}
+			// Directories that were skipped by the old patterns may need to
+			// be watched now.
+			if (args[0] == "dir" || args[0] == "xdir") && !wgoCmd.StdinFiles {
+				for _, root := range wgoCmd.Roots {
+					err := wgoCmd.addDirsRecursively(wgoCmd.watcher, root)
+					if err != nil {
+						wgoCmd.message(err.Error())
+					}
+				}
+			}
+		})
+		if !ok {
+			return "error: wgo is exiting"
+		}
+		return "ok"
+	default:
+		return "error: unknown command " + strconv.Quote(args[0])
+	}
+	if !wgoCmd.sendControl(c) {
+		return "error: wgo is exiting"
+	}
+	return "ok"
+}
+
+// controlStatus is the reply to the status command of the control socket.
+type controlStatus struct {
+	PID                int      `json:"pid"`
+	Running            bool     `json:"running"`
+	Paused             bool     `json:"paused"`
+	Runs               int      `json:"runs"`
+	Roots              []string `json:"roots"`
+	FileRegexps        []string `json:"file,omitempty"`
+	ExcludeFileRegexps []string `json:"xfile,omitempty"`
+	DirRegexps         []string `json:"dir,omitempty"`
+	ExcludeDirRegexps  []string `json:"xdir,omitempty"`
+}
+
+// status returns the current status of the WgoCmd. It must only be called by
+// the event loop.
+func (wgoCmd *WgoCmd) status() controlStatus {
+	patterns := func(regexps []*regexp.Regexp) []string {
+		var strs []string
+		for _, r := range regexps {
+			strs = append(strs, r.String())
+		}
+		return strs
+	}
+	return controlStatus{
+		PID:                os.Getpid(),
+		Running:            wgoCmd.cmdsRunning,
+		Paused:             wgoCmd.paused,
+		Runs:               wgoCmd.runs,
+		Roots:              wgoCmd.Roots,
+		FileRegexps:        patterns(wgoCmd.FileRegexps),
+		ExcludeFileRegexps: patterns(wgoCmd.ExcludeFileRegexps),
+		DirRegexps:         patterns(wgoCmd.DirRegexps),
+		ExcludeDirRegexps:  patterns(wgoCmd.ExcludeDirRegexps),
+	}
+}
+
+// controlStats is the reply to the stats command of the control socket. The
+// durations are in seconds.
+type controlStats struct {
+	Uptime       float64 `json:"uptime"`
+	Runs         int     `json:"runs"`
+	Restarts     int     `json:"restarts"`
+	Builds       int     `json:"builds"`
+	AverageBuild float64 `json:"avg_build"`
+	Readies      int     `json:"readies"`
+	AverageReady float64 `json:"avg_ready"`
+	Failures     int     `json:"failures"`
+	FailureRate  float64 `json:"failure_rate"`
+	GateFailures int     `json:"gate_failures"`
+}
+
+// stats returns the statistics of the session so far. It must only be called
+// by the event loop.
+func (wgoCmd *WgoCmd) stats() controlStats {
+	stats := controlStats{
+		Uptime:       time.Since(wgoCmd.sessionStart).Seconds(),
+		Runs:         wgoCmd.runs,
+		Builds:       wgoCmd.builds,
+		Readies:      wgoCmd.readies,
+		Failures:     wgoCmd.failures,
+		GateFailures: wgoCmd.gateFailures,
+	}
+	if wgoCmd.runs > 0 {
+		stats.Restarts = wgoCmd.runs - 1
+		stats.FailureRate = float64(wgoCmd.failures) / float64(wgoCmd.runs)
+	}
+	if wgoCmd.builds > 0 {
+		stats.AverageBuild = wgoCmd.buildTime.Seconds() / float64(wgoCmd.builds)
+	}
+	if wgoCmd.readies > 0 {
+		stats.AverageReady = wgoCmd.readyTime.Seconds() / float64(wgoCmd.readies)
+	}
+	return stats
+}
+
+// controlLastError is the reply to the last-error command of the control
+// socket. Fixed reports whether the commands have been ready since.
+type controlLastError struct {
+	Error  string    `json:"error"`
+	Output string    `json:"output"`
+	Time   time.Time `json:"time"`
+	Fixed  bool      `json:"fixed"`
+}
+
+// lastError returns the most recent failure, if anything has failed. It must
+// only be called by the event loop.
+func (wgoCmd *WgoCmd) lastError() (lastError controlLastError, failed bool) {
+	if wgoCmd.lastFailure == nil {
+		return controlLastError{}, false
+	}
+	return controlLastError{
+		Error:  wgoCmd.lastFailure.Title,
+		Output: wgoCmd.lastFailure.Output,
+		Time:   wgoCmd.lastFailureTime,
+		Fixed:  !wgoCmd.failing,
+	}, true
+}
+
+// callEventLoop calls fn from the event loop and waits for it to return, so
+// that fn can safely access the state owned by the event loop. It reports
+// false if Run returned before fn could be called.
+func (wgoCmd *WgoCmd) callEventLoop(fn func()) bool {
+	done := make(chan struct{})
+	select {
+	case wgoCmd.calls <- func() { fn(); close(done) }:
+		<-done
+		return true
+	case <-wgoCmd.runDone:
+		return false
+	}
+}
+
+// controlKeys maps keys to the controls they send.
+var controlKeys = map[byte]control{
+	'r': controlRestart,
+	'p': controlTogglePause,
+	'c': controlClear,
+	'q': controlQuit,
+}
+
+// sendControl sends a control to the event loop. It reports false if Run
+// returned before the control could be sent.
+func (wgoCmd *WgoCmd) sendControl(c control) bool {
+	select {
+	case wgoCmd.controls <- c:
+		return true
+	case <-wgoCmd.runDone:
+		return false
+	}
+}
+
+// stdinBroker continuously reads from a source (usually os.Stdin) and forwards
+// it to every command that is currently attached. Input that arrives while no
+// command is attached is held until the next command attaches, like a
+// terminal's type-ahead. Once the source reaches EOF, the attached commands'
+// stdin is closed (if it is an io.Closer) as well as the stdin of every
+// command that attaches afterwards.
+type stdinBroker struct {
+	mu      sync.Mutex
+	dsts    []io.Writer
+	pending []byte
+	eof     bool
+}
+
+// newStdinBroker starts a new stdinBroker that reads from src.
+func newStdinBroker(src io.Reader) *stdinBroker {
+	broker := &stdinBroker{}
+	go broker.run(src)
+	return broker
+}
+
+func (broker *stdinBroker) run(src io.Reader) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := src.Read(buf)
+		broker.mu.Lock()
+		if n > 0 {
+			broker.pending = append(broker.pending, buf[:n]...)
+			broker.flush()
+		}
+		if err != nil {
+			broker.eof = true
+			for _, dst := range broker.dsts {
+				if closer, ok := dst.(io.Closer); ok {
+					closer.Close()
+				}
+			}
+			broker.mu.Unlock()
+			return
+		}
+		broker.mu.Unlock()
+	}
+}
+
+// flush writes any pending input to the attached commands. The caller must
+// hold the lock.
+func (broker *stdinBroker) flush() {
+	if len(broker.dsts) == 0 || len(broker.pending) == 0 {
+		return
+	}
+	dsts := broker.dsts[:0]
+	for _, dst := range broker.dsts {
+		_, err := dst.Write(broker.pending)
+		if err != nil {
+			// The command has most likely exited.
+			continue
+		}
+		dsts = append(dsts, dst)
+	}
+	broker.dsts = dsts
+	if len(broker.dsts) == 0 {
+		// Keep the input for the next command.
+		return
+	}
+	broker.pending = broker.pending[:0]
+}
+
+// attach adds dsts to the destinations for input.
+func (broker *stdinBroker) attach(dsts ...io.Writer) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	broker.dsts = append(broker.dsts, dsts...)
+	broker.flush()
+	if broker.eof {
+		for _, dst := range dsts {
+			if closer, ok := dst.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}
+}
+
+// detach stops forwarding input to dst, if it is still attached.
+func (broker *stdinBroker) detach(dst io.Writer) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	for k := range broker.dsts {
+		if broker.dsts[k] == dst {
+			broker.dsts = append(broker.dsts[:k], broker.dsts[k+1:]...)
+			return
+		}
+	}
+}
+
+// isSeparator reports whether arg is a command separator.
+func isSeparator(arg string) bool {
+	switch arg {
+	case "::", ":;:", ":&:", ":|:":
+		return true
+	}
+	return false
+}
+
+// isEscapedSeparator reports whether arg is a command separator escaped by
+// prepending one or more extra colons e.g. ":::" or "::;:".
+func isEscapedSeparator(arg string) bool {
+	if !strings.HasPrefix(arg, ":") {
+		return false
+	}
+	return isSeparator(arg[1:]) || isEscapedSeparator(arg[1:])
+}
+
+// setDir sets the working directory of the i-th command.
+func (wgoCmd *WgoCmd) setDir(i int, dir string) {
+	for len(wgoCmd.Dirs) <= i {
+		wgoCmd.Dirs = append(wgoCmd.Dirs, "")
+	}
+	wgoCmd.Dirs[i] = dir
+}
+
+// setWait sets the dependency that the i-th command waits for.
+func (wgoCmd *WgoCmd) setWait(i int, target string) {
+	for len(wgoCmd.Waits) <= i {
+		wgoCmd.Waits = append(wgoCmd.Waits, "")
+	}
+	wgoCmd.Waits[i] = target
+}
+
+// wait returns the dependency that the i-th command waits for, if any.
+func (wgoCmd *WgoCmd) wait(i int) string {
+	if i < len(wgoCmd.Waits) {
+		return wgoCmd.Waits[i]
+	}
+	return ""
+}
+
+// dir returns the working directory of the i-th command.
+func (wgoCmd *WgoCmd) dir(i int) string {
+	if i < len(wgoCmd.Dirs) && wgoCmd.Dirs[i] != "" {
+		return wgoCmd.Dirs[i]
+	}
+	return wgoCmd.Dir
+}
+
+// separator returns the separator that follows the i-th command.
+func (wgoCmd *WgoCmd) separator(i int) string {
+	if i < len(wgoCmd.Separators) && wgoCmd.Separators[i] != "" {
+		return wgoCmd.Separators[i]
+	}
+	return "::"
+}
+
+// addMatchFlags adds the -file, -xfile, -dir and -xdir flags to the flagset,
+// which set the regexes of the default Matcher. They are shared by `wgo` and
+// `wgo match`.
+func (wgoCmd *WgoCmd) addMatchFlags(flagset *flag.FlagSet) {
+	regexpFlag := func(regexps *[]*regexp.Regexp) func(string) error {
+		return func(value string) error {
+			r, err := compileRegexp(value)
+			if err != nil {
+				return err
+			}
+			*regexps = append(*regexps, r)
+			return nil
+		}
+	}
+	flagset.Func("file", "Include file regex. Can be repeated.", regexpFlag(&wgoCmd.FileRegexps))
+	flagset.Func("xfile", "Exclude file regex. Can be repeated.", regexpFlag(&wgoCmd.ExcludeFileRegexps))
+	flagset.Func("dir", "Include directory regex. Can be repeated.", regexpFlag(&wgoCmd.DirRegexps))
+	flagset.Func("xdir", "Exclude directory regex. Can be repeated.", regexpFlag(&wgoCmd.ExcludeDirRegexps))
+}
+
+// compileRegexp is like regexp.Compile except it treats dots followed by
+// [a-zA-Z] as a dot literal. Makes expressing file extensions like .css or
+// .html easier. The user can always escape this behaviour by wrapping the dot
+// up in a grouping bracket i.e. `(.)css`.
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	n := strings.Count(pattern, ".")
+	if n == 0 {
+		return regexp.Compile(pattern)
+	}
+	if strings.HasPrefix(pattern, "./") && len(pattern) > 2 {
+		// Any pattern starting with "./" is almost certainly a mistake - it
+		// looks like it refers to the current directory when in actuality any
+		// regex starting with "./" matches nothing in the current directory
+		// because of the slash in front. Nobody every really means to match
+		// "one character followed by a slash" so we accomodate this common use
+		// case and trim the "./" prefix away.
+		pattern = pattern[2:]
+	}
+	var b strings.Builder
+	b.Grow(len(pattern) + n)
+	j := 0
+	for j < len(pattern) {
+		prev, _ := utf8.DecodeLastRuneInString(b.String())
+		curr, width := utf8.DecodeRuneInString(pattern[j:])
+		next, _ := utf8.DecodeRuneInString(pattern[j+width:])
+		j += width
+		if prev != '\\' && curr == '.' && (('a' <= next && next <= 'z') || ('A' <= next && next <= 'Z')) {
+			b.WriteString("\\.")
+		} else {
+			b.WriteRune(curr)
+		}
+	}
+	return regexp.Compile(b.String())
+}
+
+// readFileList reads a list of files from src, one file per line, and returns
+// the set of their absolute paths. Blank lines are ignored.
+func readFileList(src io.Reader) (map[string]struct{}, error) {
+	files := make(map[string]struct{})
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		file, err := filepath.Abs(line)
+		if err != nil {
+			return nil, err
+		}
+		files[file] = struct{}{}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// matchEvent reports whether the file event should restart the commands,
+// tracing why not. The event is recorded for Record first, and new
+// directories are watched. files is the -stdin-files list, if any, and
+// generated has the modification times of the files written by `go generate`.
+func (wgoCmd *WgoCmd) matchEvent(watcher *fsnotify.Watcher, event fsnotify.Event, files map[string]struct{}, generated map[string]time.Time) bool {
+	// The events on wgo's own files (such as the -record file itself) are not
+	// recorded.
+	if _, ok := wgoCmd.ownFiles[event.Name]; !ok && wgoCmd.recorder != nil {
+		wgoCmd.recorder.record(event)
+	}
+	name := filepath.ToSlash(event.Name)
+	wgoCmd.trace("event", event.Op.String(), name)
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) && !event.Has(fsnotify.Remove) {
+		wgoCmd.trace("ignore", name+":", "not a CREATE, WRITE or REMOVE event")
+		return false
+	}
+	fileinfo, err := os.Stat(event.Name)
+	if err != nil {
+		wgoCmd.trace("ignore", name+":", err)
+		return false
+	}
+	if _, ok := wgoCmd.ownFiles[event.Name]; ok {
+		wgoCmd.trace("ignore", name+":", "written by wgo itself")
+		return false
+	}
+	if modTime, ok := generated[event.Name]; ok && fileinfo.ModTime().Equal(modTime) {
+		wgoCmd.trace("ignore", name+":", "written by go generate")
+		return false
+	}
+	if files != nil {
+		if _, ok := files[event.Name]; !ok {
+			wgoCmd.trace("ignore", name+":", "not in the -stdin-files list")
+			return false
+		}
+		if wgoCmd.paused {
+			wgoCmd.trace("ignore", name+":", "paused")
+			return false
+		}
+		wgoCmd.Logger.Println(event.Op.String(), name)
+		return true
+	}
+	if fileinfo.IsDir() {
+		wgoCmd.trace("ignore", name+":", "directory")
+		if event.Has(fsnotify.Create) {
+			err := wgoCmd.addDirsRecursively(watcher, event.Name)
+			if err != nil {
+				wgoCmd.message(err.Error())
+			}
+		}
+		return false
+	}
+	if wgoCmd.paused {
+		wgoCmd.trace("ignore", name+":", "paused")
+		return false
+	}
+	return wgoCmd.match(event.Op.String(), event.Name)
+}
+
+// sendBatches sends the debounced file events on Batches until the context is
+// canceled.
+func (wgoCmd *WgoCmd) sendBatches(watcher *fsnotify.Watcher, fileEvents <-chan fsnotify.Event, files map[string]struct{}) {
+	timer := time.NewTimer(0)
+	timer.Stop()
+	var batch []fsnotify.Event
+	for {
+		select {
+		case <-wgoCmd.ctx.Done():
+			return
+		case err := <-watcher.Errors:
+			wgoCmd.Logger.Println(err)
+		case event := <-fileEvents:
+			if !wgoCmd.matchEvent(watcher, event, files, nil) {
+				continue
+			}
+			if wgoCmd.OnFileEvent != nil {
+				wgoCmd.OnFileEvent(event)
+			}
+			batch = append(batch, event)
+			timer.Reset(wgoCmd.Debounce)
+			wgoCmd.trace("debounce", "reset, sending the batch in", wgoCmd.Debounce)
+		case <-timer.C:
+			wgoCmd.trace("debounce", "expired")
+			select {
+			case wgoCmd.Batches <- batch:
+			case <-wgoCmd.ctx.Done():
+				return
+			}
+			batch = nil
+		}
+	}
+}
+
+// replayEvents sends the recorded events of `wgo replay` that are meant for
+// the WgoCmd on the channel, as long after Run was called as they were
+// recorded, until Run returns.
+func (wgoCmd *WgoCmd) replayEvents(events chan<- fsnotify.Event) {
+	start := time.Now()
+	replayed := 0
+	for _, recorded := range wgoCmd.replay {
+		if recorded.Name != "" && recorded.Name != wgoCmd.Name {
+			continue
+		}
+		timer := time.NewTimer(time.Until(start.Add(time.Duration(recorded.Elapsed * float64(time.Second)))))
+		select {
+		case <-wgoCmd.runDone:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		select {
+		case <-wgoCmd.runDone:
+			return
+		case events <- recorded.fsnotifyEvent(wgoCmd.Roots[0]):
+			replayed++
+		}
+	}
+	if replayed == 1 {
+		wgoCmd.message("replay: replayed 1 file event")
+	} else {
+		wgoCmd.message(fmt.Sprintf("replay: replayed %d file events", replayed))
+	}
+}
+
+// addDirsRecursively adds directories recursively to a watcher since it
+// doesn't support it natively https://github.com/fsnotify/fsnotify/issues/18.
+// A nice side effect is that we get to log the watched directories as we go.
+// The directories that can't be watched are skipped, and the error of the
+// first one is returned as a *WatcherSetupError.
+func (wgoCmd *WgoCmd) addDirsRecursively(watcher *fsnotify.Watcher, dir string) error {
+	roots := make(map[string]struct{})
+	for _, root := range wgoCmd.Roots {
+		roots[root] = struct{}{}
+	}
+	matcher := wgoCmd.matcher()
+	var firstErr error
+	add := func(path string) {
+		err := watcher.Add(path)
+		if err != nil && firstErr == nil {
+			firstErr = &WatcherSetupError{Path: path, Err: err}
+		}
+	}
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		normalizedDir := filepath.ToSlash(path)
+		_, isRoot := roots[path]
+		if isRoot {
+			if !wgoCmd.isDepDir(path) {
+				return nil
+			}
+			wgoCmd.Logger.Println("WATCH", normalizedDir)
+			add(path)
+			return nil
+		}
+		for _, root := range wgoCmd.Roots {
+			if strings.HasPrefix(path, root+string(filepath.Separator)) {
+				normalizedDir = filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+				break
+			}
+		}
+		if !matcher.MatchDir(path) {
+			return filepath.SkipDir
+		}
+		if !wgoCmd.isDepDir(path) {
+			return nil // Its subdirectories may still be imported.
+		}
+		wgoCmd.Logger.Println("WATCH", normalizedDir)
+		add(path)
+		return nil
+	})
+	return firstErr
+}
+
+// generate runs `go generate` in each of the dirs that contain a
+// //go:generate directive, and records the modification times of the files in
+// the dirs that were written to in generated.
+func (wgoCmd *WgoCmd) generate(dirs map[string]struct{}, generated map[string]time.Time) {
+	sortedDirs := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sortedDirs = append(sortedDirs, dir)
+	}
+	sort.Strings(sortedDirs)
+	for _, dir := range sortedDirs {
+		modTimes := readModTimes(dir)
+		hasDirective := false
+		for name := range modTimes {
+			if strings.HasSuffix(name, ".go") && hasGenerateDirective(name) {
+				hasDirective = true
+				break
+			}
+		}
+		if !hasDirective {
+			continue
+		}
+		args := []string{wgoCmd.goCommand(), "generate", "."}
+		cmd, err := wgoCmd.command(args)
+		if err != nil {
+			wgoCmd.message("-generate: " + err.Error())
+			return
+		}
+		cmd.Dir = dir
+		wgoCmd.Logger.Println("EXECUTING", joinArgs(args), "in", filepath.ToSlash(dir))
+		err = cmd.Run()
+		if err != nil {
+			wgoCmd.message("-generate: go generate failed in " + filepath.ToSlash(dir) + ": " + err.Error())
+		}
+		for name, modTime := range readModTimes(dir) {
+			if previous, ok := modTimes[name]; !ok || !previous.Equal(modTime) {
+				generated[name] = modTime
+			}
+		}
+	}
+}
+
+// readModTimes returns the modification times of the files in dir.
+func readModTimes(dir string) map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fileinfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		modTimes[filepath.Join(dir, entry.Name())] = fileinfo.ModTime()
+	}
+	return modTimes
+}
+
+// hasGenerateDirective reports whether the Go file contains a //go:generate
+// directive.
+func hasGenerateDirective(name string) bool {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(line, "//go:generate ") {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceDirs returns the absolute paths of the local directories that modules
+// are replaced with in the go.mod of dir (or one of its parent directories).
+func replaceDirs(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	for {
+		b, err = os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+	var dirs []string
+	inBlock := false
+	for _, line := range strings.Split(string(b), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if inBlock {
+			if line == ")" {
+				inBlock = false
+				continue
+			}
+		} else if line == "replace (" {
+			inBlock = true
+			continue
+		} else if strings.HasPrefix(line, "replace ") {
+			line = strings.TrimPrefix(line, "replace ")
+		} else {
+			continue
+		}
+		i := strings.Index(line, "=>")
+		if i < 0 {
+			continue
+		}
+		// Only filesystem paths are local, see
+		// https://go.dev/ref/mod#go-mod-file-replace.
+		target := strings.Fields(line[i+2:])
+		if len(target) != 1 {
+			continue
+		}
+		path := strings.Trim(target[0], `"`)
+		if !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") && !filepath.IsAbs(path) &&
+			!strings.HasPrefix(path, `.\`) && !strings.HasPrefix(path, `..\`) {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		dirs = append(dirs, filepath.Clean(path))
+	}
+	return dirs, nil
+}
+
+// isDepDir reports whether dir should be watched for Deps. If FileRegexps are
+// provided, the files could be anywhere, so every directory is watched.
+func (wgoCmd *WgoCmd) isDepDir(dir string) bool {
+	if !wgoCmd.Deps || wgoCmd.packages == nil || len(wgoCmd.FileRegexps) > 0 {
+		return true
+	}
+	if _, ok := wgoCmd.packages.dirs[dir]; ok {
+		return true
+	}
+	for _, embed := range wgoCmd.packages.embeds {
+		base := embed.base()
+		if dir == base || strings.HasPrefix(dir, base+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// match checks if a given file path should trigger a reload. The op string is
+// provided only for logging purposes, it is not actually used.
+func (wgoCmd *WgoCmd) match(op string, path string) bool {
+	matched, reason := wgoCmd.matcher().MatchFile(path)
+	if matched && wgoCmd.Filter != "" {
+		matched, reason = wgoCmd.filter(op, path)
+	}
+	normalizedFile, _ := wgoCmd.normalizePath(path)
+	if wgoCmd.Explain || wgoCmd.Trace {
+		normalizedFile += " (" + reason + ")"
+	}
+	if matched {
+		wgoCmd.Logger.Println(op, normalizedFile)
+	} else {
+		wgoCmd.Logger.Println("(skip)", op, normalizedFile)
+	}
+	return matched
+}
+
+// filterEvent is the JSON object that the Filter script reads from its stdin.
+type filterEvent struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	File string `json:"file"` // Relative to the root, as matched by -file.
+}
+
+// filterTimeout is how long the Filter script has to decide on a file event.
+const filterTimeout = 5 * time.Second
+
+// filter runs the Filter script for a file event that matched, and reports
+// whether the event should trigger a reload and the reason why.
+func (wgoCmd *WgoCmd) filter(op string, path string) (matched bool, reason string) {
+	normalizedFile, _ := wgoCmd.normalizePath(path)
+	b, err := json.Marshal(filterEvent{Op: op, Path: path, File: normalizedFile})
+	if err != nil {
+		return false, "-filter: " + err.Error()
+	}
+	cmd, err := wgoCmd.shellCommand(wgoCmd.Filter)
+	if err != nil {
+		wgoCmd.message("-filter: " + err.Error())
+		return false, "-filter: " + err.Error()
+	}
+	var stdout bytes.Buffer
+	cmd.Stdin = bytes.NewReader(append(b, '\n'))
+	cmd.Stdout = &stdout
+	err = cmd.Start()
+	if err != nil {
+		wgoCmd.message("-filter: " + err.Error())
+		return false, "-filter: " + err.Error()
+	}
+	waitDone := make(chan error, 1)
+	go func() {
+		waitDone <- cmd.Wait()
+	}()
+	timer := time.NewTimer(filterTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-waitDone:
+	case <-timer.C:
+		kill(cmd)
+		<-waitDone
+		err = fmt.Errorf("timed out after %s", filterTimeout)
+	case <-wgoCmd.ctx.Done():
+		kill(cmd)
+		<-waitDone
+		return false, "-filter: " + wgoCmd.ctx.Err().Error()
+	}
+	reason = strings.TrimSpace(stdout.String())
+	if i := strings.IndexByte(reason, '\n'); i >= 0 {
+		reason = strings.TrimSpace(reason[:i])
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		if reason == "" {
+			reason = "allowed by -filter"
+		}
+		return true, reason
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		if reason == "" {
+			reason = "skipped by -filter"
+		}
+		return false, reason
+	default:
+		wgoCmd.message("-filter: " + normalizedFile + ": " + err.Error())
+		return false, "-filter: " + err.Error()
+	}
+}
+
+// normalizePath returns the path of the file (and of its directory) relative
+// to the root that it is in, with forward slashes. This is what the -file,
+// -xfile, -dir and -xdir regexes are matched against.
+func (wgoCmd *WgoCmd) normalizePath(path string) (normalizedFile, normalizedDir string) {
+	normalizedFile = filepath.ToSlash(path)
+	for _, root := range wgoCmd.Roots {
+		root += string(os.PathSeparator)
+		if strings.HasPrefix(path, root) {
+			normalizedFile = filepath.ToSlash(strings.TrimPrefix(path, root))
+			break
+		}
+	}
+	return normalizedFile, filepath.ToSlash(filepath.Dir(normalizedFile))
+}
+
+// Matcher decides which file events restart the commands of a WgoCmd and which
+// directories it watches. Paths are absolute. Programs that embed WgoCmd can
+// set WgoCmd.Matcher to match files some other way, such as with the
+// .gitignore files or the import graph of a project, optionally falling back
+// to WgoCmd.DefaultMatcher.
+type Matcher interface {
+	// MatchFile reports whether a change to the file at path should restart
+	// the commands, and the reason why (which is logged by -explain).
+	MatchFile(path string) (matched bool, reason string)
+
+	// MatchDir reports whether the directory at path (which is never one of
+	// the roots) should be watched. If not, its subdirectories aren't either.
+	MatchDir(path string) bool
+}
+
+// matcher returns the Matcher of the WgoCmd.
+func (wgoCmd *WgoCmd) matcher() Matcher {
+	if wgoCmd.Matcher != nil {
+		return wgoCmd.Matcher
+	}
+	return defaultMatcher{wgoCmd: wgoCmd}
+}
+
+// DefaultMatcher returns the Matcher that is used if Matcher is nil, which
+// matches the FileRegexps, ExcludeFileRegexps, DirRegexps and
+// ExcludeDirRegexps (and for `wgo run`, the non-test .go files of the packages
+// and the files embedded by their //go:embed directives). It skips
+// directories like .git and node_modules unless they match the DirRegexps.
+func (wgoCmd *WgoCmd) DefaultMatcher() Matcher {
+	return defaultMatcher{wgoCmd: wgoCmd}
+}
+
+// defaultMatcher is the Matcher returned by DefaultMatcher. It reads the
+// regexes from the WgoCmd every time, so that the changes made by the control
+// socket take effect.
+type defaultMatcher struct {
+	wgoCmd *WgoCmd
+}
+
+// MatchDir implements Matcher.
+func (matcher defaultMatcher) MatchDir(path string) bool {
+	wgoCmd := matcher.wgoCmd
+	normalizedDir, _ := wgoCmd.normalizePath(path)
+	for _, r := range wgoCmd.ExcludeDirRegexps {
+		if r.MatchString(normalizedDir) {
+			return false
+		}
+	}
+	for _, r := range wgoCmd.DirRegexps {
+		if r.MatchString(normalizedDir) {
+			return true
+		}
+	}
+	name := filepath.Base(path)
+	switch name {
+	case ".git", ".hg", ".svn", ".idea", ".vscode", ".settings", "node_modules":
+		return false
+	}
+	return !strings.HasPrefix(name, ".")
+}
+
+// MatchFile implements Matcher.
+func (matcher defaultMatcher) MatchFile(path string) (matched bool, reason string) {
+	wgoCmd := matcher.wgoCmd
+	normalizedFile, normalizedDir := wgoCmd.normalizePath(path)
+	for _, r := range wgoCmd.ExcludeDirRegexps {
+		if r.MatchString(normalizedDir) {
+			return false, "excluded by -xdir " + r.String()
+		}
+	}
+	if len(wgoCmd.DirRegexps) > 0 {
+		matched := false
+		for _, r := range wgoCmd.DirRegexps {
+			if r.MatchString(normalizedDir) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, "directory not matched by any -dir"
+		}
+	}
+	for _, r := range wgoCmd.ExcludeFileRegexps {
+		if r.MatchString(normalizedFile) {
+			return false, "excluded by -xfile " + r.String()
+		}
+	}
+	for _, r := range wgoCmd.FileRegexps {
+		if r.MatchString(normalizedFile) {
+			return true, "matched by -file " + r.String()
+		}
+	}
+	if wgoCmd.isRun {
+		packages := wgoCmd.packages
+		if packages == nil {
+			packages = &goPackages{}
+		}
+		for _, embed := range packages.embeds {
+			if embed.match(path) {
+				return true, "matched by //go:embed " + embed.pattern
+			}
+		}
+		if strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go") {
+			if _, isIgnored := packages.ignored[path]; isIgnored {
+				// The change may have edited the build constraints of the
+				// file, so check them again. The packages themselves are
+				// listed again before the next restart, which also watches
+				// any newly imported packages.
+				buildContext := wgoCmd.buildContext()
+				if ok, err := buildContext.MatchFile(filepath.Dir(path), filepath.Base(path)); err != nil || !ok {
+					return false, ".go file excluded by build constraints"
+				}
+				return true, ".go file no longer excluded by build constraints"
+			}
+			if _, isDep := packages.dirs[filepath.Dir(path)]; wgoCmd.Deps && wgoCmd.packages != nil && !isDep {
+				return false, "package not imported by the main package, -deps"
+			}
+			return true, ".go file, wgo run"
+		}
+		if len(wgoCmd.FileRegexps) > 0 {
+			return false, "not a .go file and not matched by any -file"
+		}
+		return false, "not a .go file, wgo run"
+	}
+	if len(wgoCmd.FileRegexps) == 0 {
+		return true, "no -file given, every file matches"
+	}
+	return false, "not matched by any -file"
+}
+
+// trace logs a line of the event tracing of Trace.
+func (wgoCmd *WgoCmd) trace(v ...interface{}) {
+	if wgoCmd.Trace {
+		wgoCmd.Logger.Println(append([]interface{}{"TRACE"}, v...)...)
+	}
+}
+
+// staleBinaryRegexp matches the names of the temporary binaries built by `wgo
+// run`. The first submatch is the PID of the wgo that built the binary, unless
+// the name comes from an older wgo which did not put its PID in the name (in
+// which case the second submatch is empty).
+var staleBinaryRegexp = regexp.MustCompile(`^wgo_\d{14}_(\d+)(_\d+)?(_alt|_build\d+)?(\.exe)?$`)
+
+// removeStaleBinaries removes the temporary binaries in dir that were left
+// behind by a wgo that did not exit cleanly, such as a wgo that crashed or was
+// killed. A binary is stale if the wgo that built it is no longer running.
+// Binaries without a PID in their name are stale if they are older than a day.
+// It returns the number of binaries removed.
+func removeStaleBinaries(dir string) (removed int, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		matches := staleBinaryRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		if matches[2] != "" {
+			pid, err := strconv.Atoi(matches[1])
+			if err != nil || pid == os.Getpid() || processExists(pid) {
+				continue
+			}
+		} else {
+			fileinfo, err := entry.Info()
+			if err != nil || time.Since(fileinfo.ModTime()) < 24*time.Hour {
+				continue
+			}
+		}
+		// A binary that is still in use can't be removed on Windows, which
+		// is fine because it is not stale.
+		if os.Remove(filepath.Join(dir, entry.Name())) == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// copyFile copies the file src to dst, keeping its permissions.
+func copyFile(dst, src string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	fileinfo, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileinfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dstFile, srcFile)
+	if err != nil {
+		dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
+
+// isRemoved reports whether the event removed (or renamed away) a file that
+// would have matched, so that Sync deletes it from the destination too.
+func (wgoCmd *WgoCmd) isRemoved(event fsnotify.Event, files map[string]struct{}) bool {
+	if (!event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename)) || wgoCmd.paused {
+		return false
+	}
+	if _, err := os.Lstat(event.Name); err == nil {
+		return false
+	}
+	if files != nil {
+		_, ok := files[event.Name]
+		return ok
+	}
+	matched, _ := wgoCmd.matcher().MatchFile(event.Name)
+	return matched
+}
+
+// syncFiles returns the files to copy for Sync and the files to delete from
+// the destination because they no longer exist, relative to the first root
+// and in sorted order. Files outside the first root are left out.
+func (wgoCmd *WgoCmd) syncFiles(files map[string]struct{}) (changed, removed []string) {
+	for file := range files {
+		name, err := filepath.Rel(wgoCmd.Roots[0], file)
+		if err != nil || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if _, err := os.Lstat(file); err != nil {
+			removed = append(removed, filepath.ToSlash(name))
+			continue
+		}
+		changed = append(changed, filepath.ToSlash(name))
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// rsyncDeleteArgs returns the rsync arguments that delete the removed files
+// (and nothing else) from the destination: --delete removes every file that
+// doesn't exist locally, but the filter rules limit it to the removed files
+// and the directories that lead to them. This works with every rsync, unlike
+// --delete-missing-args (which the rsync 2.6.9 and openrsync of macOS lack).
+func rsyncDeleteArgs(removed []string, dest string) []string {
+	// Escape the wildcard characters, so that each pattern only matches its
+	// own file.
+	escape := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`).Replace
+	args := []string{"rsync", "-r", "--delete"}
+	dirs := make(map[string]struct{})
+	for _, name := range removed {
+		parts := strings.Split(name, "/")
+		for i := 1; i < len(parts); i++ {
+			dir := strings.Join(parts[:i], "/")
+			if _, ok := dirs[dir]; !ok {
+				dirs[dir] = struct{}{}
+				args = append(args, "--include=/"+escape(dir)+"/")
+			}
+		}
+		args = append(args, "--include=/"+escape(name))
+	}
+	return append(args, "--exclude=*", "./", dest)
+}
+
+// sync copies the changed files to the Sync destination with rsync, and then
+// deletes the removed files from it. A failing rsync is only logged.
+func (wgoCmd *WgoCmd) sync(files map[string]struct{}) {
+	changed, removed := wgoCmd.syncFiles(files)
+	if len(changed) > 0 {
+		args := []string{"rsync", "-az", "--files-from=-", ".", wgoCmd.Sync}
+		wgoCmd.rsync(args, strings.Join(changed, "\n")+"\n", strings.Join(changed, " "))
+	}
+	if len(removed) > 0 {
+		wgoCmd.rsync(rsyncDeleteArgs(removed, wgoCmd.Sync), "", "(delete) "+strings.Join(removed, " "))
+	}
+}
+
+// rsync runs rsync for sync in the first root, with stdin as its input.
+func (wgoCmd *WgoCmd) rsync(args []string, stdin, files string) {
+	cmd, err := wgoCmd.command(args)
+	if err != nil {
+		wgoCmd.message("-sync: " + err.Error())
+		return
+	}
+	cmd.Dir = wgoCmd.Roots[0]
+	cmd.Stdin = strings.NewReader(stdin)
+	wgoCmd.Logger.Println("EXECUTING", joinArgs(args), "<", files)
+	err = cmd.Run()
+	if err != nil {
+		wgoCmd.message("-sync: rsync failed: " + err.Error())
+	}
+}
@@ -0,0 +1,266 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultControlSocket is the name of the control socket that `wgo ctl` looks
+// for if no -socket flag is provided.
+const defaultControlSocket = ".wgo.sock"
+
+// WgoCtl implements the `wgo ctl` command, which sends a command to the
+// control socket of a running wgo (see WgoCmd.ControlSocket) and writes the
+// reply to stdout. The args should not include the leading "wgo ctl".
+func WgoCtl(args []string, stdout io.Writer) error {
+	var socket string
+	flagset := flag.NewFlagSet("", flag.ContinueOnError)
+	flagset.StringVar(&socket, "socket", "", "Path to the control socket. Defaults to the nearest "+defaultControlSocket+" in the current directory or its parents.")
+	flagset.Usage = func() {
+		fmt.Fprint(flagset.Output(), `Usage:
+  wgo ctl [FLAGS] <command> [ARGUMENTS...]
+  wgo ctl restart
+  wgo ctl pause
+  wgo ctl resume
+  wgo ctl status
+  wgo ctl -socket /tmp/wgo.sock file '\.go$' '\.html$'
+Commands:
+  restart (or trigger)         Restart the commands.
+  stop                         Stop the commands until the next file event.
+  run-once                     Start the commands if they are not running.
+  rollback                     Restart the last command with the previous build (-keep-builds).
+  pause                        Ignore file events.
+  resume                       Stop ignoring file events.
+  status                       Report the status of wgo as a JSON object.
+  stats                        Report the statistics of the session as a JSON object (see wgo stats).
+  last-error                   Report the most recent failure and its output as a JSON object (see wgo last-error).
+  file|xfile|dir|xdir [REGEX]  Replace the -file/-xfile/-dir/-xdir patterns.
+Flags:
+`)
+		flagset.PrintDefaults()
+	}
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flagset.NArg() == 0 {
+		flagset.Usage()
+		return fmt.Errorf("wgo ctl: command not provided")
+	}
+	reply, err := controlRoundTrip(socket, strings.Join(flagset.Args(), " "))
+	if err != nil {
+		return fmt.Errorf("wgo ctl: %w", err)
+	}
+	// Indent the status so that it is easier to read.
+	if strings.HasPrefix(reply, "{") {
+		var b bytes.Buffer
+		if json.Indent(&b, []byte(reply), "", "  ") == nil {
+			reply = b.String()
+		}
+	}
+	_, err = fmt.Fprintln(stdout, reply)
+	return err
+}
+
+// WgoStats implements the `wgo stats` command, which reports the statistics of
+// the session of a running wgo (restarts, build times and failures) by sending
+// the stats command to its control socket. The args should not include the
+// leading "wgo stats".
+func WgoStats(args []string, stdout io.Writer) error {
+	var socket string
+	var jsonOutput bool
+	flagset := flag.NewFlagSet("", flag.ContinueOnError)
+	flagset.StringVar(&socket, "socket", "", "Path to the control socket. Defaults to the nearest "+defaultControlSocket+" in the current directory or its parents.")
+	flagset.BoolVar(&jsonOutput, "json", false, "Print the statistics as a JSON object.")
+	flagset.Usage = func() {
+		fmt.Fprint(flagset.Output(), `Usage:
+  wgo stats [FLAGS]
+  wgo stats
+  wgo stats -json
+  wgo stats -socket /tmp/wgo.sock
+Flags:
+`)
+		flagset.PrintDefaults()
+	}
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flagset.NArg() > 0 {
+		flagset.Usage()
+		return fmt.Errorf("wgo stats: unexpected arguments %s", strings.Join(flagset.Args(), " "))
+	}
+	reply, err := controlRoundTrip(socket, "stats")
+	if err != nil {
+		return fmt.Errorf("wgo stats: %w", err)
+	}
+	var stats controlStats
+	err = json.Unmarshal([]byte(reply), &stats)
+	if err != nil {
+		return fmt.Errorf("wgo stats: %w", err)
+	}
+	if jsonOutput {
+		b, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return fmt.Errorf("wgo stats: %w", err)
+		}
+		_, err = fmt.Fprintln(stdout, string(b))
+		return err
+	}
+	_, err = io.WriteString(stdout, formatStats(stats))
+	return err
+}
+
+// WgoLastError implements the `wgo last-error` command, which shows the output
+// of the most recent failure of a running wgo (such as the compiler errors of
+// a failed build) by sending the last-error command to its control socket,
+// without triggering another build. The args should not include the leading
+// "wgo last-error".
+func WgoLastError(args []string, stdout io.Writer) error {
+	var socket string
+	var jsonOutput bool
+	flagset := flag.NewFlagSet("", flag.ContinueOnError)
+	flagset.StringVar(&socket, "socket", "", "Path to the control socket. Defaults to the nearest "+defaultControlSocket+" in the current directory or its parents.")
+	flagset.BoolVar(&jsonOutput, "json", false, "Print the failure as a JSON object.")
+	flagset.Usage = func() {
+		fmt.Fprint(flagset.Output(), `Usage:
+  wgo last-error [FLAGS]
+  wgo last-error
+  wgo last-error -json
+  wgo last-error -socket /tmp/wgo.sock
+Flags:
+`)
+		flagset.PrintDefaults()
+	}
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flagset.NArg() > 0 {
+		flagset.Usage()
+		return fmt.Errorf("wgo last-error: unexpected arguments %s", strings.Join(flagset.Args(), " "))
+	}
+	reply, err := controlRoundTrip(socket, "last-error")
+	if err != nil {
+		return fmt.Errorf("wgo last-error: %w", err)
+	}
+	var lastError controlLastError
+	err = json.Unmarshal([]byte(reply), &lastError)
+	if err != nil {
+		return fmt.Errorf("wgo last-error: %w", err)
+	}
+	if jsonOutput {
+		b, err := json.MarshalIndent(lastError, "", "  ")
+		if err != nil {
+			return fmt.Errorf("wgo last-error: %w", err)
+		}
+		_, err = fmt.Fprintln(stdout, string(b))
+		return err
+	}
+	_, err = io.WriteString(stdout, formatLastError(lastError))
+	return err
+}
+
+// formatLastError formats the failure the way wgo reported it: the output,
+// followed by the error and when it happened.
+func formatLastError(lastError controlLastError) string {
+	var b strings.Builder
+	b.WriteString(lastError.Output)
+	if lastError.Output != "" && !strings.HasSuffix(lastError.Output, "\n") {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "[wgo] %s (at %s", lastError.Error, lastError.Time.Local().Format("15:04:05"))
+	if lastError.Fixed {
+		b.WriteString(", fixed since")
+	}
+	b.WriteString(")\n")
+	return b.String()
+}
+
+// formatStats formats the statistics for people to read.
+func formatStats(stats controlStats) string {
+	seconds := func(s float64) time.Duration {
+		return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "uptime         %s\n", time.Duration(stats.Uptime*float64(time.Second)).Round(time.Second))
+	fmt.Fprintf(&b, "runs           %d (%d restarts)\n", stats.Runs, stats.Restarts)
+	if stats.Builds > 0 {
+		fmt.Fprintf(&b, "builds         %d, %s on average\n", stats.Builds, seconds(stats.AverageBuild))
+	}
+	if stats.Readies > 0 {
+		fmt.Fprintf(&b, "ready          %d times, %s on average after a (re)start\n", stats.Readies, seconds(stats.AverageReady))
+	}
+	fmt.Fprintf(&b, "failures       %d (%.1f%% of runs)\n", stats.Failures, stats.FailureRate*100)
+	if stats.GateFailures > 0 {
+		fmt.Fprintf(&b, "gate failures  %d\n", stats.GateFailures)
+	}
+	return b.String()
+}
+
+// controlRoundTrip sends a command to the control socket of a running wgo and
+// returns its reply. If socket is empty, the nearest defaultControlSocket is
+// used. A reply starting with "error: " is returned as an error.
+func controlRoundTrip(socket, command string) (string, error) {
+	if socket == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		socket, err = findProjectFile(cwd, defaultControlSocket, "start wgo with -socket "+defaultControlSocket)
+		if err != nil {
+			return "", err
+		}
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_, err = fmt.Fprintln(conn, command)
+	if err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	reply = strings.TrimSpace(reply)
+	if strings.HasPrefix(reply, "error: ") {
+		return "", errors.New(strings.TrimPrefix(reply, "error: "))
+	}
+	return reply, nil
+}
+
+// findProjectFile looks for a file with the given name in dir and its parent
+// directories, so that commands like `wgo ctl` can be used from anywhere
+// inside a project. The hint is appended to the error if the file can't be
+// found.
+func findProjectFile(dir, name, hint string) (string, error) {
+	for current := dir; ; {
+		file := filepath.Join(current, name)
+		_, err := os.Lstat(file)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", fmt.Errorf("no %s found in %s or any of its parent directories (%s)", name, dir, hint)
+		}
+		current = parent
+	}
+}
@@ -0,0 +1,256 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitUntil calls condition every 100ms until it returns true, failing the
+// test if that takes longer than 10 seconds.
+func waitUntil(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + what)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// waitStats waits until the wgo command listening on socket has become ready
+// the given number of times, and returns its stats.
+func waitStats(t *testing.T, socket string, readies int) controlStats {
+	t.Helper()
+	var stats controlStats
+	waitUntil(t, "the stats", func() bool {
+		stdout := &Buffer{}
+		err := WgoStats([]string{"-socket", socket, "-json"}, stdout)
+		if err != nil {
+			return false
+		}
+		stats = controlStats{}
+		err = json.Unmarshal([]byte(stdout.String()), &stats)
+		return err == nil && stats.Readies >= readies
+	})
+	return stats
+}
+
+func TestWgoCtl(t *testing.T) {
+	t.Parallel()
+	socket := filepath.Join(t.TempDir(), defaultControlSocket)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wgoCmd, err := WgoCommand(ctx, []string{"-socket", socket, "-file", "\\.nomatch$", "go", "run", "./testdata/args", "apple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &Buffer{}
+	wgoCmd.Stdout = buf
+	wgoCmd.Stderr = &Buffer{}
+	cmdResult := make(chan error)
+	go func() {
+		cmdResult <- wgoCmd.Run()
+	}()
+	waitUntil(t, "the first run", func() bool {
+		return strings.Count(buf.String(), "[apple]") == 1 && WgoCtl([]string{"-socket", socket, "status"}, &Buffer{}) == nil
+	})
+
+	stdout := &Buffer{}
+	err = WgoCtl([]string{"-socket", socket, "pause"}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WgoCtl([]string{"-socket", socket, "status"}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WgoCtl([]string{"-socket", socket, "restart"}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WgoCtl([]string{"-socket", socket, "bogus"}, stdout)
+	wantErr := `wgo ctl: unknown command "bogus"`
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("\ngot:  %v\nwant: %s", err, wantErr)
+	}
+	waitUntil(t, "the restart", func() bool {
+		return strings.Count(buf.String(), "[apple]") == 2
+	})
+
+	cancel()
+	err = <-cmdResult
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := stdout.String()
+	if !strings.HasPrefix(got, "ok\n{\n") || !strings.Contains(got, `  "paused": true,`) || !strings.HasSuffix(got, "}\nok\n") {
+		t.Errorf("unexpected output: %q", got)
+	}
+	got = strings.TrimSpace(buf.String())
+	want := "[apple]\n[apple]"
+	if got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestWgoStats(t *testing.T) {
+	t.Parallel()
+	socket := filepath.Join(t.TempDir(), defaultControlSocket)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wgoCmd, err := WgoCommand(ctx, []string{"run", "-socket", socket, "-file", "\\.nomatch$", "./testdata/args", "apple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wgoCmd.Stdout = &Buffer{}
+	wgoCmd.Stderr = &Buffer{}
+	cmdResult := make(chan error)
+	go func() {
+		cmdResult <- wgoCmd.Run()
+	}()
+	stats := waitStats(t, socket, 1)
+	cancel()
+	err = <-cmdResult
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Runs != 1 || stats.Restarts != 0 || stats.Builds != 1 || stats.Readies != 1 || stats.Failures != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.AverageBuild <= 0 || stats.AverageReady < stats.AverageBuild {
+		t.Errorf("unexpected durations: %+v", stats)
+	}
+}
+
+func TestWgoLastError(t *testing.T) {
+	t.Parallel()
+	socket := filepath.Join(t.TempDir(), defaultControlSocket)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wgoCmd, err := WgoCommand(ctx, []string{"-socket", socket, "-file", "\\.nomatch$", "go", "build", "./testdata/nonexistent", "::", "go", "run", "./testdata/args", "apple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wgoCmd.Stdout = &Buffer{}
+	wgoCmd.Stderr = &Buffer{}
+	cmdResult := make(chan error)
+	go func() {
+		cmdResult <- wgoCmd.Run()
+	}()
+	stdout := &Buffer{}
+	waitUntil(t, "the build failure", func() bool {
+		stdout = &Buffer{}
+		return WgoLastError([]string{"-socket", socket, "-json"}, stdout) == nil
+	})
+	cancel()
+	err = <-cmdResult
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lastError controlLastError
+	err = json.Unmarshal([]byte(stdout.String()), &lastError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(lastError.Error, "go failed: ") || !strings.Contains(lastError.Output, "nonexistent") || lastError.Time.IsZero() || lastError.Fixed {
+		t.Errorf("unexpected last error: %+v", lastError)
+	}
+}
+
+func TestWgoLastError_none(t *testing.T) {
+	t.Parallel()
+	socket := filepath.Join(t.TempDir(), defaultControlSocket)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wgoCmd, err := WgoCommand(ctx, []string{"run", "-socket", socket, "-file", "\\.nomatch$", "./testdata/args", "apple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wgoCmd.Stdout = &Buffer{}
+	wgoCmd.Stderr = &Buffer{}
+	cmdResult := make(chan error)
+	go func() {
+		cmdResult <- wgoCmd.Run()
+	}()
+	waitStats(t, socket, 1)
+	err = WgoLastError([]string{"-socket", socket}, &Buffer{})
+	cancel()
+	<-cmdResult
+	if got, want := fmt.Sprint(err), "wgo last-error: nothing has failed yet"; got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func Test_formatLastError(t *testing.T) {
+	t.Parallel()
+	lastError := controlLastError{
+		Error:  "go failed: exit status 1",
+		Output: "# example.com/app\n./main.go:5:2: undefined: foo",
+		Time:   time.Date(2024, 1, 2, 14, 2, 11, 0, time.Local),
+		Fixed:  true,
+	}
+	want := "# example.com/app\n" +
+		"./main.go:5:2: undefined: foo\n" +
+		"[wgo] go failed: exit status 1 (at 14:02:11, fixed since)\n"
+	if got := formatLastError(lastError); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func Test_formatStats(t *testing.T) {
+	t.Parallel()
+	got := formatStats(controlStats{
+		Uptime:       3723.4,
+		Runs:         42,
+		Restarts:     41,
+		Builds:       42,
+		AverageBuild: 2.1034,
+		Readies:      37,
+		AverageReady: 2.6,
+		Failures:     5,
+		FailureRate:  5.0 / 42,
+		GateFailures: 2,
+	})
+	want := "uptime         1h2m3s\n" +
+		"runs           42 (41 restarts)\n" +
+		"builds         42, 2.103s on average\n" +
+		"ready          37 times, 2.6s on average after a (re)start\n" +
+		"failures       5 (11.9% of runs)\n" +
+		"gate failures  2\n"
+	if got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func Test_findProjectFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	nestedDir := filepath.Join(dir, "foo", "bar")
+	err := os.MkdirAll(nestedDir, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = findProjectFile(nestedDir, defaultControlSocket, "")
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	err = os.WriteFile(filepath.Join(dir, defaultControlSocket), nil, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := findProjectFile(nestedDir, defaultControlSocket, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, defaultControlSocket)
+	if got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
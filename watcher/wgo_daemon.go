@@ -0,0 +1,173 @@
+package watcher
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultPIDFile is where -daemon writes the PID of wgo if no -pid-file
+	// flag is provided.
+	defaultPIDFile = ".wgo.pid"
+
+	// defaultDaemonLog is where -daemon writes the output of wgo if no
+	// -daemon-log flag is provided.
+	defaultDaemonLog = ".wgo.log"
+
+	// daemonEnv is set in the environment of the background wgo started by
+	// -daemon, so that it knows not to start yet another background wgo.
+	daemonEnv = "WGO_DAEMON"
+)
+
+// startDaemon starts wgo in the background with the given args (os.Args),
+// writes its PID to pidFile and redirects its output to logFile.
+func startDaemon(args []string, pidFile, logFile string, stdout io.Writer) error {
+	if pidFile == "" {
+		pidFile = defaultPIDFile
+	}
+	if logFile == "" {
+		logFile = defaultDaemonLog
+	}
+	pid, err := readPIDFile(pidFile)
+	if err == nil && processExists(pid) {
+		return fmt.Errorf("-daemon: wgo is already running in the background (pid %d)", pid)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("-daemon: %w", err)
+	}
+	file, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("-daemon: %w", err)
+	}
+	defer file.Close()
+	cmd := exec.Command(exe, args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdout = file
+	cmd.Stderr = file
+	detach(cmd)
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("-daemon: %w", err)
+	}
+	// Write the PID file here instead of in the background wgo so that it is
+	// already there by the time `wgo status` or `wgo stop` is called.
+	err = os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("-daemon: %w", err)
+	}
+	fmt.Fprintf(stdout, "wgo is running in the background (pid %d), its output is written to %s\n", cmd.Process.Pid, logFile)
+	return cmd.Process.Release()
+}
+
+// isDaemon reports whether the current process is the background wgo started
+// by -daemon.
+func isDaemon() bool {
+	return os.Getenv(daemonEnv) != ""
+}
+
+// removePIDFile removes the PID file if it still belongs to the current
+// process.
+func removePIDFile(pidFile string) {
+	pid, err := readPIDFile(pidFile)
+	if err == nil && pid == os.Getpid() {
+		_ = os.Remove(pidFile)
+	}
+}
+
+// readPIDFile reads the PID stored in pidFile.
+func readPIDFile(pidFile string) (int, error) {
+	b, err := os.ReadFile(pidFile)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(b)))
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid PID: %w", pidFile, err)
+	}
+	return pid, nil
+}
+
+// daemonPID parses the flags of `wgo stop` and `wgo status` and returns the
+// PID file of the background wgo as well as the PID stored in it.
+func daemonPID(name string, args []string) (pidFile string, pid int, err error) {
+	flagset := flag.NewFlagSet("", flag.ContinueOnError)
+	flagset.StringVar(&pidFile, "pid-file", "", "Path to the PID file. Defaults to the nearest "+defaultPIDFile+" in the current directory or its parents.")
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage:\n  wgo %s [FLAGS]\nFlags:\n", name)
+		flagset.PrintDefaults()
+	}
+	err = flagset.Parse(args)
+	if err != nil {
+		return "", 0, err
+	}
+	if pidFile == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", 0, err
+		}
+		pidFile, err = findProjectFile(cwd, defaultPIDFile, "is wgo running with -daemon?")
+		if err != nil {
+			return "", 0, fmt.Errorf("wgo %s: %w", name, err)
+		}
+	}
+	pid, err = readPIDFile(pidFile)
+	if err != nil {
+		return "", 0, fmt.Errorf("wgo %s: %w", name, err)
+	}
+	return pidFile, pid, nil
+}
+
+// WgoStatus implements the `wgo status` command, which reports whether the
+// background wgo started by -daemon is running. It returns an error if it
+// isn't.
+func WgoStatus(args []string, stdout io.Writer) error {
+	_, pid, err := daemonPID("status", args)
+	if err != nil {
+		return err
+	}
+	if !processExists(pid) {
+		return fmt.Errorf("wgo status: wgo is not running (pid %d has exited)", pid)
+	}
+	fmt.Fprintf(stdout, "wgo is running (pid %d)\n", pid)
+	return nil
+}
+
+// WgoStop implements the `wgo stop` command, which stops the background wgo
+// started by -daemon and waits for it to exit.
+func WgoStop(args []string, stdout io.Writer) error {
+	pidFile, pid, err := daemonPID("stop", args)
+	if err != nil {
+		return err
+	}
+	if processExists(pid) {
+		err = terminate(pid)
+		if err != nil {
+			return fmt.Errorf("wgo stop: %w", err)
+		}
+		// Give wgo time to stop its commands and run its teardown scripts.
+		deadline := time.Now().Add(10 * time.Second)
+		for processExists(pid) {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("wgo stop: wgo (pid %d) did not exit", pid)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	// The background wgo removes its own PID file when it exits, unless it
+	// was killed before it could do so.
+	err = os.Remove(pidFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("wgo stop: %w", err)
+	}
+	fmt.Fprintf(stdout, "wgo (pid %d) stopped\n", pid)
+	return nil
+}
@@ -0,0 +1,65 @@
+package watcher
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWgoStatusAndStop(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	binPath := filepath.Join(dir, "signal")
+	if runtime.GOOS == "windows" {
+		binPath += ".exe"
+	}
+	err := exec.Command("go", "build", "-o", binPath, "./testdata/signal").Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(binPath, "-trap-signal")
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitDone := make(chan struct{})
+	go func() {
+		defer close(waitDone)
+		_ = cmd.Wait()
+	}()
+	time.Sleep(time.Second)
+	pidFile := filepath.Join(dir, defaultPIDFile)
+	err = os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &Buffer{}
+	err = WgoStatus([]string{"-pid-file", pidFile}, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WgoStop([]string{"-pid-file", pidFile}, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-waitDone
+	got := buf.String()
+	want := "wgo is running (pid " + strconv.Itoa(cmd.Process.Pid) + ")\n" +
+		"wgo (pid " + strconv.Itoa(cmd.Process.Pid) + ") stopped\n"
+	if got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	_, err = os.Stat(pidFile)
+	if !os.IsNotExist(err) {
+		t.Errorf("PID file was not removed: %v", err)
+	}
+	err = WgoStatus([]string{"-pid-file", pidFile}, buf)
+	if err == nil {
+		t.Error("expected an error, got nil")
+	}
+}
@@ -0,0 +1,106 @@
+package watcher
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// BuildFailedError is the error of a command in the chain that failed, such as
+// the `go build` of `wgo run`. It is passed to WgoCmd.OnBuildFailure.
+type BuildFailedError struct {
+	// Args is the command that failed and its arguments.
+	Args []string
+
+	// Output is the recent output of the commands, such as the compiler
+	// errors.
+	Output string
+
+	// Err is why the command failed, usually a *ProcessExitError.
+	Err error
+
+	dir string // The directory that the command ran in, see WgoCmd.dir().
+}
+
+// Error implements error.
+func (err *BuildFailedError) Error() string {
+	name := ""
+	if len(err.Args) > 0 {
+		name = err.Args[0]
+	}
+	return name + " failed: " + err.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (err *BuildFailedError) Unwrap() error {
+	return err.Err
+}
+
+// WatcherSetupError is the error of a file or directory that couldn't be
+// watched, for example because the limit on the number of inotify watches has
+// been reached. Run returns it if the watcher (or one of the roots) couldn't
+// be set up.
+type WatcherSetupError struct {
+	// Path is the file or directory that couldn't be watched. It is empty if
+	// the watcher itself couldn't be created.
+	Path string
+
+	// Err is the error returned by fsnotify.
+	Err error
+}
+
+// Error implements error.
+func (err *WatcherSetupError) Error() string {
+	if err.Path == "" {
+		return "watcher: " + err.Err.Error()
+	}
+	return "watch " + err.Path + ": " + err.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (err *WatcherSetupError) Unwrap() error {
+	return err.Err
+}
+
+// ProcessExitError is the error of a command that exited unsuccessfully. With
+// WgoCmd.Exit, Run returns it if the last command does.
+type ProcessExitError struct {
+	// Args is the command and its arguments.
+	Args []string
+
+	// ExitCode is the exit code of the command, or -1 if it was killed by a
+	// signal (or didn't exit at all).
+	ExitCode int
+
+	// Signal is the signal that killed the command, if any. It is always nil
+	// on Windows.
+	Signal os.Signal
+
+	// Err is the error returned by (*exec.Cmd).Wait, usually an
+	// *exec.ExitError.
+	Err error
+}
+
+// newProcessExitError returns the ProcessExitError of a command that has been
+// waited for.
+func newProcessExitError(cmd *exec.Cmd, err error) *ProcessExitError {
+	exitErr := &ProcessExitError{Args: cmd.Args, ExitCode: -1, Err: err}
+	if cmd.ProcessState != nil {
+		exitErr.ExitCode = cmd.ProcessState.ExitCode()
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			exitErr.Signal = status.Signal()
+		}
+	}
+	return exitErr
+}
+
+// Error implements error. It is the same as the error of (*exec.Cmd).Wait,
+// such as "exit status 1" or "signal: killed".
+func (err *ProcessExitError) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (err *ProcessExitError) Unwrap() error {
+	return err.Err
+}
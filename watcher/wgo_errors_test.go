@@ -0,0 +1,114 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWgoCmd_ProcessExitError(t *testing.T) {
+	t.Parallel()
+	wgoCmd, err := WgoCommand(context.Background(), []string{"-exit", "go", "nonexistent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wgoCmd.Stdout = &Buffer{}
+	wgoCmd.Stderr = &Buffer{}
+	err = wgoCmd.Run()
+	var exitErr *ProcessExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected a *ProcessExitError, got %#v", err)
+	}
+	if exitErr.ExitCode != 2 {
+		t.Errorf("expected exit code 2, got %d", exitErr.ExitCode)
+	}
+	if exitErr.Signal != nil {
+		t.Errorf("expected no signal, got %v", exitErr.Signal)
+	}
+	if diff := Diff([]string{"go", "nonexistent"}, exitErr.Args); diff != "" {
+		t.Error(diff)
+	}
+	if got, want := err.Error(), "exit status 2"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWgoCmd_BuildFailedError(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wgoCmd, err := WgoCommand(ctx, []string{"go", "nonexistent", "::", "go", "run", "./testdata/args", "apple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wgoCmd.Stdout = &Buffer{}
+	wgoCmd.Stderr = &Buffer{}
+	failures := make(chan error, 1)
+	wgoCmd.OnBuildFailure = func(err error, output string) {
+		failures <- err
+	}
+	cmdResult := make(chan error)
+	go func() {
+		cmdResult <- wgoCmd.Run()
+	}()
+	var failure error
+	select {
+	case failure = <-failures:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the build failure")
+	}
+	cancel()
+	err = <-cmdResult
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buildErr *BuildFailedError
+	if !errors.As(failure, &buildErr) {
+		t.Fatalf("expected a *BuildFailedError, got %#v", failure)
+	}
+	if diff := Diff([]string{"go", "nonexistent"}, buildErr.Args); diff != "" {
+		t.Error(diff)
+	}
+	if !strings.Contains(buildErr.Output, "unknown command") {
+		t.Errorf("output %q does not contain the error of go", buildErr.Output)
+	}
+	var exitErr *ProcessExitError
+	if !errors.As(failure, &exitErr) || exitErr.ExitCode != 2 {
+		t.Errorf("expected a *ProcessExitError with exit code 2, got %#v", failure)
+	}
+	if got, want := failure.Error(), "go failed: exit status 2"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWatcherSetupError(t *testing.T) {
+	t.Parallel()
+	errNoSpace := errors.New("no space left on device")
+	tests := []struct {
+		description string
+		err         *WatcherSetupError
+		want        string
+	}{{
+		description: "watcher",
+		err:         &WatcherSetupError{Err: errors.New("too many open files")},
+		want:        "watcher: too many open files",
+	}, {
+		description: "path",
+		err:         &WatcherSetupError{Path: "/home/user/project/static", Err: errNoSpace},
+		want:        "watch /home/user/project/static: no space left on device",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.description, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if !errors.Is(tests[1].err, errNoSpace) {
+		t.Error("expected the WatcherSetupError to unwrap to its Err")
+	}
+}
@@ -0,0 +1,160 @@
+package watcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lifecycleEvent is a line of the -events stream. Event is one of "change",
+// "restart", "build_start", "build_finish", "start", "exit", "ready" or
+// "failed".
+type lifecycleEvent struct {
+	Time     time.Time `json:"time"`
+	Name     string    `json:"name,omitempty"`
+	Event    string    `json:"event"`
+	Op       string    `json:"op,omitempty"`
+	File     string    `json:"file,omitempty"`
+	Command  string    `json:"command,omitempty"`
+	PID      int       `json:"pid,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Duration float64   `json:"duration,omitempty"` // In seconds.
+	Error    string    `json:"error,omitempty"`
+}
+
+// eventStream writes lifecycleEvents as JSON lines (NDJSON) to a file
+// descriptor, a file or the clients of a unix socket.
+type eventStream struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+}
+
+// openEventStream opens the destination of the -events stream: "fd:N" is the
+// file descriptor N inherited from the parent process, "unix:PATH" is a unix
+// socket that wgo listens on and anything else is a file that the events are
+// appended to. It must be closed once it is no longer needed.
+func openEventStream(dest string) (*eventStream, error) {
+	stream := &eventStream{}
+	switch {
+	case strings.HasPrefix(dest, "fd:"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(dest, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid file descriptor %q", strings.TrimPrefix(dest, "fd:"))
+		}
+		file := os.NewFile(uintptr(fd), dest)
+		if file == nil {
+			return nil, fmt.Errorf("invalid file descriptor %d", fd)
+		}
+		if _, err := file.Stat(); err != nil {
+			return nil, fmt.Errorf("file descriptor %d is not open", fd)
+		}
+		// The commands must not inherit the stream, or a reader waiting
+		// for it to be closed would wait until the commands exit too.
+		closeOnExec(uintptr(fd))
+		stream.w = file
+	case strings.HasPrefix(dest, "unix:"):
+		ln, err := listenUnixSocket(strings.TrimPrefix(dest, "unix:"))
+		if err != nil {
+			return nil, err
+		}
+		stream.ln = ln
+		stream.conns = make(map[net.Conn]struct{})
+		go stream.accept()
+	default:
+		file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, err
+		}
+		stream.w = file
+		stream.closer = file
+	}
+	return stream, nil
+}
+
+// listenUnixSocket listens on the unix socket at path (for -socket and
+// -events). A socket file left behind by a previous wgo that didn't exit
+// cleanly is removed.
+func listenUnixSocket(path string) (net.Listener, error) {
+	ln, err := net.Listen("unix", path)
+	if err == nil {
+		return ln, nil
+	}
+	fileinfo, statErr := os.Lstat(path)
+	if statErr != nil || fileinfo.Mode()&os.ModeSocket == 0 {
+		return nil, err
+	}
+	conn, dialErr := net.Dial("unix", path)
+	if dialErr == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is already in use by another wgo", path)
+	}
+	err = os.Remove(path)
+	if err != nil {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// accept adds the clients that connect to the unix socket until it is closed.
+func (stream *eventStream) accept() {
+	for {
+		conn, err := stream.ln.Accept()
+		if err != nil {
+			return
+		}
+		stream.mu.Lock()
+		stream.conns[conn] = struct{}{}
+		stream.mu.Unlock()
+	}
+}
+
+// send writes the event to the stream. Clients of the unix socket that don't
+// keep up are disconnected rather than holding up the commands.
+func (stream *eventStream) send(event lifecycleEvent) {
+	event.Time = time.Now()
+	b, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.w != nil {
+		_, _ = stream.w.Write(b)
+	}
+	for conn := range stream.conns {
+		_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_, err := conn.Write(b)
+		if err != nil {
+			conn.Close()
+			delete(stream.conns, conn)
+		}
+	}
+}
+
+// Close closes the file or the unix socket and its clients. A file descriptor
+// inherited from the parent is left open.
+func (stream *eventStream) Close() error {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	for conn := range stream.conns {
+		conn.Close()
+		delete(stream.conns, conn)
+	}
+	if stream.ln != nil {
+		return stream.ln.Close()
+	}
+	if stream.closer != nil {
+		return stream.closer.Close()
+	}
+	return nil
+}
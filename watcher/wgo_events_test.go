@@ -0,0 +1,101 @@
+package watcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	t.Parallel()
+	socket := filepath.Join(t.TempDir(), "events.sock")
+	stream, err := openEventStream("unix:" + socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Wait for the client to be accepted.
+	for i := 0; i < 100; i++ {
+		stream.mu.Lock()
+		n := len(stream.conns)
+		stream.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stream.send(lifecycleEvent{Event: "change", Op: "WRITE", File: "/home/user/project/main.go"})
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event lifecycleEvent
+	err = json.Unmarshal([]byte(line), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != "change" || event.Op != "WRITE" || event.File != "/home/user/project/main.go" || event.Time.IsZero() {
+		t.Errorf("unexpected event: %#v", event)
+	}
+	if strings.Contains(line, "exit_code") || strings.Contains(line, "duration") {
+		t.Errorf("unexpected fields in %q", line)
+	}
+
+	_, err = openEventStream("fd:x")
+	if err == nil {
+		t.Error("expected an error for fd:x, got nil")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+	file := filepath.Join(t.TempDir(), "events.ndjson")
+	wgoCmd, err := WgoCommand(context.Background(), []string{"run", "-exit", "-events", file, "./testdata/args", "apple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wgoCmd.Stdout = &Buffer{}
+	wgoCmd.Stderr = &Buffer{}
+	err = wgoCmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(map[string]lifecycleEvent)
+	var order []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var event lifecycleEvent
+		err := json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		events[event.Event] = event
+		order = append(order, event.Event)
+	}
+	if len(order) != 5 || order[0] != "build_start" || order[1] != "build_finish" || order[2] != "start" {
+		t.Fatalf("unexpected events: %v", order)
+	}
+	if build := events["build_finish"]; build.ExitCode == nil || *build.ExitCode != 0 || build.Duration <= 0 {
+		t.Errorf("unexpected build_finish event: %#v", build)
+	}
+	if exit := events["exit"]; exit.ExitCode == nil || *exit.ExitCode != 0 || exit.PID != events["start"].PID || !strings.HasSuffix(exit.Command, " apple") {
+		t.Errorf("unexpected exit event: %#v", exit)
+	}
+	if _, ok := events["ready"]; !ok {
+		t.Errorf("no ready event: %v", order)
+	}
+}
@@ -0,0 +1,161 @@
+package watcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// liveReloadScript is served at /livereload.js by the livereload server. It
+// connects to the livereload event stream next to it on the server it was
+// loaded from and reloads the page whenever a reload event arrives. A failure
+// event puts an error overlay over the page, until the next reload.
+// EventSource reconnects by itself if the connection drops.
+const liveReloadScript = `(function () {
+  var script = document.currentScript;
+  var url = script ? new URL("livereload", script.src) : "/livereload";
+  var source = new EventSource(url);
+  source.addEventListener("reload", function () {
+    location.reload();
+  });
+  source.addEventListener("failure", function (event) {
+    var failure = JSON.parse(event.data);
+    var overlay = document.getElementById("wgo-overlay");
+    if (!overlay) {
+      overlay = document.createElement("pre");
+      overlay.id = "wgo-overlay";
+      overlay.style.cssText = "` + overlayStyle + `";
+      overlay.title = "Click to dismiss";
+      overlay.onclick = function () {
+        overlay.parentNode.removeChild(overlay);
+      };
+      document.body.appendChild(overlay);
+    }
+    overlay.textContent = "";
+    var title = document.createElement("b");
+    title.style.color = "#ff6b6b";
+    title.textContent = failure.title;
+    overlay.appendChild(title);
+    overlay.appendChild(document.createTextNode("\n\n" + failure.output));
+  });
+})();
+`
+
+// liveReloadSnippet returns the HTML that loads the livereload script from the
+// livereload server listening on addr (over https if secure). If the server
+// listens on every interface, the script is loaded from the same host as the
+// page.
+func liveReloadSnippet(addr string, secure bool) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	hostname := "location.hostname"
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		if ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+		hostname = strconv.Quote(host)
+	} else if ip == nil && host != "" {
+		hostname = strconv.Quote(host)
+	}
+	scheme := "http://"
+	if secure {
+		scheme = "https://"
+	}
+	return `<script>(function () {
+  var script = document.createElement("script");
+  script.src = "` + scheme + `" + ` + hostname + ` + ":` + port + `/livereload.js";
+  document.head.appendChild(script);
+})();</script>
+`
+}
+
+// liveReload is an HTTP handler that tells the connected browsers to reload
+// the page (or show a build failure), using server-sent events.
+type liveReload struct {
+	mu      sync.Mutex
+	clients map[chan string]struct{} // The events waiting to be sent to each browser.
+}
+
+// newLiveReload returns a new liveReload without any connected browsers.
+func newLiveReload() *liveReload {
+	return &liveReload{clients: make(map[chan string]struct{})}
+}
+
+// ServeHTTP serves the event stream at /livereload and the script that
+// connects to it at /livereload.js.
+func (lr *liveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The page being reloaded is served from a different origin (the app
+	// itself), so it needs permission to read the event stream.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	switch r.URL.Path {
+	case "/livereload.js":
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprint(w, liveReloadScript)
+	case "/livereload":
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		events := make(chan string, 8)
+		lr.mu.Lock()
+		lr.clients[events] = struct{}{}
+		lr.mu.Unlock()
+		defer func() {
+			lr.mu.Lock()
+			delete(lr.clients, events)
+			lr.mu.Unlock()
+		}()
+		// Send a comment so that the browser knows it is connected.
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-events:
+				_, err := fmt.Fprint(w, event)
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// reload tells every connected browser to reload the page.
+func (lr *liveReload) reload() {
+	lr.send("event: reload\ndata: {}\n\n")
+}
+
+// fail tells every connected browser to show the failure over the page.
+func (lr *liveReload) fail(failure *buildFailure) {
+	b, err := json.Marshal(failure)
+	if err != nil {
+		return
+	}
+	lr.send("event: failure\ndata: " + string(b) + "\n\n")
+}
+
+// send sends the event to every connected browser.
+func (lr *liveReload) send(event string) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	for events := range lr.clients {
+		select {
+		case events <- event:
+		default: // The browser isn't keeping up, it will have to miss one.
+		}
+	}
+}
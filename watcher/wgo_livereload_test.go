@@ -0,0 +1,93 @@
+package watcher
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLiveReload(t *testing.T) {
+	t.Parallel()
+	lr := newLiveReload()
+	server := httptest.NewServer(lr)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/livereload.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != liveReloadScript {
+		t.Errorf("got %q, want the livereload script", string(b))
+	}
+
+	resp, err = http.Get(server.URL + "/livereload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type is %q, want text/event-stream", got)
+	}
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+	// The browser is registered by the time the first comment arrives.
+	if got := readEvent(); got != ": connected\n" {
+		t.Fatalf("got %q, want %q", got, ": connected\n")
+	}
+	lr.reload()
+	want := "event: reload\ndata: {}\n"
+	if got := readEvent(); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	lr.fail(&buildFailure{Title: "go failed: exit status 1", Output: "./main.go:5:2: undefined: foo\n"})
+	want = `event: failure` + "\n" + `data: {"title":"go failed: exit status 1","output":"./main.go:5:2: undefined: foo\n"}` + "\n"
+	if got := readEvent(); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func Test_liveReloadSnippet(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		addr     string
+		secure   bool
+		hostname string
+	}{
+		{"[::]:35729", false, `"http://" + location.hostname + ":35729`},
+		{"0.0.0.0:35729", false, `"http://" + location.hostname + ":35729`},
+		{"127.0.0.1:35729", false, `"http://" + "127.0.0.1" + ":35729`},
+		{"[::1]:35729", false, `"http://" + "[::1]" + ":35729`},
+		{"localhost:35729", true, `"https://" + "localhost" + ":35729`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.addr, func(t *testing.T) {
+			t.Parallel()
+			got := liveReloadSnippet(tt.addr, tt.secure)
+			want := `script.src = ` + tt.hostname + `/livereload.js";`
+			if !strings.Contains(got, want) {
+				t.Errorf("\ngot:  %q\nwant: %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package watcher
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// jsonLogEntry is a line of the JSON logs of -log-format json.
+type jsonLogEntry struct {
+	Time    time.Time `json:"time"`
+	Elapsed float64   `json:"elapsed"`        // Seconds since the commands last started.
+	Name    string    `json:"name,omitempty"` // The name of the WgoCmd, if it has one.
+	Event   string    `json:"event,omitempty"`
+	Message string    `json:"msg,omitempty"`
+}
+
+// logEventRegexp matches the uppercase word that starts a log line of an
+// event, such as WATCH, EXECUTING or CREATE|WRITE.
+var logEventRegexp = regexp.MustCompile(`^[A-Z][A-Z_|]*$`)
+
+// jsonLogWriter is an io.Writer that writes every log line written to it as a
+// jsonLogEntry on its own line. The event of a log line is its first word if
+// that word is uppercase. File events that were skipped ("(skip) WRITE
+// file") are SKIP events.
+type jsonLogWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	name    string
+	started *int64 // When the commands last started in Unix nanoseconds. Accessed atomically.
+}
+
+// Write implements io.Writer. Each call is one log line, like the calls made
+// by a log.Logger.
+func (jw *jsonLogWriter) Write(p []byte) (n int, err error) {
+	now := time.Now()
+	entry := jsonLogEntry{
+		Time:    now,
+		Elapsed: now.Sub(time.Unix(0, atomic.LoadInt64(jw.started))).Seconds(),
+		Name:    jw.name,
+		Message: strings.TrimSuffix(string(p), "\n"),
+	}
+	word, rest := entry.Message, ""
+	if i := strings.IndexByte(entry.Message, ' '); i >= 0 {
+		word, rest = entry.Message[:i], entry.Message[i+1:]
+	}
+	if word == "(skip)" {
+		entry.Event, entry.Message = "SKIP", rest
+	} else if logEventRegexp.MatchString(word) {
+		entry.Event, entry.Message = word, rest
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	_, err = jw.w.Write(append(b, '\n'))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// defaultLogFileSize is the size at which the log file of -log-file is rotated
+// if no size is given.
+const defaultLogFileSize = 10 << 20
+
+// logFileBackups is how many rotated log files are kept, named after the log
+// file with a .1, .2 or .3 suffix (.1 being the most recent).
+const logFileBackups = 3
+
+// rotatingFile is an io.Writer that appends to a log file. Once the file grows
+// past maxSize, it is renamed to NAME.1 (NAME.1 becomes NAME.2 and so on, the
+// oldest backup being removed) and a new file is started.
+type rotatingFile struct {
+	mu      sync.Mutex
+	name    string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+// openRotatingFile opens the log file, creating it if necessary.
+func openRotatingFile(name string, maxSize int64) (*rotatingFile, error) {
+	rf := &rotatingFile{name: name, maxSize: maxSize}
+	err := rf.open()
+	if err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file, rf.size = file, fileInfo.Size()
+	return nil
+}
+
+// Write implements io.Writer. The file is rotated before a write that would
+// make it grow past maxSize, so a write is never split across two files.
+func (rf *rotatingFile) Write(p []byte) (n int, err error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		err = rf.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err = rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate moves the log file to NAME.1 and starts a new one.
+func (rf *rotatingFile) rotate() error {
+	rf.file.Close()
+	rf.file = nil
+	for i := logFileBackups - 1; i > 0; i-- {
+		name := rf.name + "." + strconv.Itoa(i)
+		if _, err := os.Stat(name); err == nil {
+			// Windows can't rename over an existing file.
+			os.Remove(rf.name + "." + strconv.Itoa(i+1))
+			os.Rename(name, rf.name+"."+strconv.Itoa(i+1))
+		}
+	}
+	os.Remove(rf.name + ".1")
+	err := os.Rename(rf.name, rf.name+".1")
+	// If the file couldn't be moved, keep appending to it.
+	openErr := rf.open()
+	if err != nil {
+		return err
+	}
+	return openErr
+}
+
+// Close closes the log file.
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
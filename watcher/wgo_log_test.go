@@ -0,0 +1,93 @@
+package watcher
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_jsonLogWriter(t *testing.T) {
+	t.Parallel()
+	buf := &Buffer{}
+	started := time.Now().Add(-2 * time.Second).UnixNano()
+	jw := &jsonLogWriter{w: buf, name: "api", started: &started}
+	for _, line := range []string{
+		"WATCH /home/user/project\n",
+		"(skip) CREATE|WRITE /home/user/project/.git/index\n",
+		"EXECUTING go build -o out .\n",
+		"READY\n",
+		"-wait: localhost:5432 was not ready after 30s, starting anyway\n",
+	} {
+		n, err := jw.Write([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(line) {
+			t.Errorf("Write(%q) = %d, want %d", line, n, len(line))
+		}
+	}
+	var got []jsonLogEntry
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var entry jsonLogEntry
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		if entry.Elapsed < 2 || entry.Elapsed > 60 {
+			t.Errorf("%s: elapsed is %v, want about 2", line, entry.Elapsed)
+		}
+		if entry.Time.IsZero() {
+			t.Errorf("%s: time is zero", line)
+		}
+		entry.Time, entry.Elapsed = time.Time{}, 0
+		got = append(got, entry)
+	}
+	want := []jsonLogEntry{
+		{Name: "api", Event: "WATCH", Message: "/home/user/project"},
+		{Name: "api", Event: "SKIP", Message: "CREATE|WRITE /home/user/project/.git/index"},
+		{Name: "api", Event: "EXECUTING", Message: "go build -o out ."},
+		{Name: "api", Event: "READY"},
+		{Name: "api", Message: "-wait: localhost:5432 was not ready after 30s, starting anyway"},
+	}
+	if diff := Diff(got, want); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_rotatingFile(t *testing.T) {
+	t.Parallel()
+	name := filepath.Join(t.TempDir(), "wgo.log")
+	rf, err := openRotatingFile(name, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	// Every line fits in the file, but no two lines do.
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n", "fifth\n"} {
+		_, err := rf.Write([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]string{
+		name:        "fifth\n",
+		name + ".1": "fourth\n",
+		name + ".2": "third\n",
+		name + ".3": "second\n",
+	}
+	for name, want := range want {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(b); got != want {
+			t.Errorf("%s: got %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(name + ".4"); err == nil {
+		t.Errorf("%s.4 exists, only %d backups should be kept", filepath.Base(name), logFileBackups)
+	}
+}
@@ -0,0 +1,182 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// Main runs the wgo commands in args (os.Args, including the leading "wgo")
+// the way the wgo command line tool does: in parallel, in their own tmux panes
+// for -tmux, in the background for -daemon or in a dashboard for -tui. If
+// args[1] is "replay", the commands are fed the file events of a -record file
+// instead of watching for file events. Main returns once every command has
+// exited (or the context is canceled) with the exit code of wgo, which is the
+// exit code of the last command if it made wgo exit.
+//
+// The subcommands (`wgo ctl`, `wgo serve`, etc.) are not handled by Main, see
+// WgoCtl, WgoStats, WgoLastError, WgoStatus, WgoStop, WgoServe and WgoMatch.
+func Main(ctx context.Context, args []string) (exitCode int) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// `wgo replay` runs the commands like wgo does, but feeds them the file
+	// events recorded by -record instead of watching for file events.
+	cmdArgs := args
+	var recording []recordedEvent
+	if len(args) > 1 && args[1] == "replay" {
+		if len(args) < 4 {
+			log.Print("Usage: wgo replay <events.log> [FLAGS] <command> [ARGUMENTS...]")
+			return 1
+		}
+		var err error
+		recording, err = readRecording(args[2])
+		if err != nil {
+			log.Print("wgo replay: ", err)
+			return 1
+		}
+		if len(recording) == 0 {
+			log.Print("wgo replay: no events in ", args[2])
+			return 1
+		}
+		cmdArgs = append([]string{args[0]}, args[3:]...)
+	}
+
+	// Construct the list of WgoCmds from the args.
+	wgoCmds, err := WgoCommands(ctx, cmdArgs)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		log.Print(err)
+		return 1
+	}
+	for _, wgoCmd := range wgoCmds {
+		wgoCmd.replay = recording
+	}
+
+	// If -tmux was provided, run each wgo command in its own tmux pane and
+	// exit (or rather, attach to the tmux session).
+	for _, wgoCmd := range wgoCmds {
+		if !wgoCmd.Tmux || isTmuxPane() {
+			continue
+		}
+		err := startTmux(args)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		return 0
+	}
+
+	// If -daemon was provided, restart wgo in the background and exit.
+	var pidFile string
+	for _, wgoCmd := range wgoCmds {
+		if !wgoCmd.Daemon {
+			continue
+		}
+		if !isDaemon() {
+			err := startDaemon(args, wgoCmd.PIDFile, wgoCmd.DaemonLog, os.Stdout)
+			if err != nil {
+				log.Print(err)
+				return 1
+			}
+			return 0
+		}
+		pidFile = wgoCmd.PIDFile
+		if pidFile == "" {
+			pidFile = defaultPIDFile
+		}
+		break
+	}
+
+	// If wgo was started by systemd socket activation, pass the sockets on to
+	// the first WgoCmd.
+	wgoCmds[0].ListenFiles = systemdListenFiles()
+
+	// If -tui was provided, show every WgoCmd in its own pane of a dashboard.
+	var stopTUI func()
+	for _, wgoCmd := range wgoCmds {
+		if !wgoCmd.TUI {
+			continue
+		}
+		if !isTerminal(os.Stdout) {
+			fmt.Fprintln(os.Stderr, "[wgo] -tui: stdout is not a terminal, ignoring -tui")
+			break
+		}
+		names := make([]string, len(wgoCmds))
+		for i, wgoCmd := range wgoCmds {
+			names[i] = wgoCmd.Name
+			if names[i] == "" {
+				names[i] = wgoCmd.defaultName()
+			}
+		}
+		dashboard := newTUIDashboard(names)
+		for i, wgoCmd := range wgoCmds {
+			wgoCmd := wgoCmd
+			pane := dashboard.panes[i]
+			pane.keys = func(key byte) {
+				wgoCmd.sendControl(controlKeys[key])
+			}
+			wgoCmd.pane = pane
+			wgoCmd.Stdout = pane
+			wgoCmd.Stderr = pane
+			if wgoCmd.Logger != defaultLogger {
+				wgoCmd.Logger.SetOutput(pane)
+			}
+		}
+		stopTUI = startTUI(dashboard, os.Stdout, os.Stdin, cancel)
+		break
+	}
+
+	// Run the WgoCmds in parallel.
+	results := make(chan error, len(wgoCmds))
+	var wg sync.WaitGroup
+	for _, wgoCmd := range wgoCmds {
+		wgoCmd := wgoCmd
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- wgoCmd.Run()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Wait for results. While the dashboard is shown, the errors are printed
+	// once it is closed.
+	var errs []error
+	for err := range results {
+		if err != nil {
+			if stopTUI == nil {
+				fmt.Println(err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	if stopTUI != nil {
+		stopTUI()
+		for _, err := range errs {
+			fmt.Println(err)
+		}
+	}
+	if pidFile != "" {
+		removePIDFile(pidFile)
+	}
+	if len(errs) == 0 {
+		return 0
+	}
+	// With -exit, wgo exits with the exit code of the last command (if it is
+	// the only error) so that a supervisor can tell why it exited.
+	var exitErr *ProcessExitError
+	if len(errs) == 1 && errors.As(errs[0], &exitErr) && exitErr.ExitCode > 0 {
+		return exitErr.ExitCode
+	}
+	return 1
+}
@@ -0,0 +1,62 @@
+package watcher
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WgoMatch implements the `wgo match` command, which reports whether changes
+// to the given paths would restart a wgo with the same -file, -xfile, -dir and
+// -xdir flags (and why), without watching or running anything. The args
+// should not include the leading "wgo match".
+func WgoMatch(args []string, stdout io.Writer) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	wgoCmd := &WgoCmd{Roots: []string{cwd}}
+	flagset := flag.NewFlagSet("", flag.ContinueOnError)
+	flagset.Func("root", "Specify an additional root directory. Can be repeated.", func(value string) error {
+		root, err := filepath.Abs(value)
+		if err != nil {
+			return err
+		}
+		wgoCmd.Roots = append(wgoCmd.Roots, root)
+		return nil
+	})
+	wgoCmd.addMatchFlags(flagset)
+	flagset.Usage = func() {
+		fmt.Fprint(flagset.Output(), `Usage:
+  wgo match [FLAGS] <path> [PATHS...]
+  wgo match -file .css -xdir vendor styles.css vendor/bootstrap.css
+  wgo match -xfile _test.go main.go main_test.go
+Flags:
+`)
+		flagset.PrintDefaults()
+	}
+	err = flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flagset.NArg() == 0 {
+		flagset.Usage()
+		return fmt.Errorf("wgo match: no paths provided")
+	}
+	for _, arg := range flagset.Args() {
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return fmt.Errorf("wgo match: %w", err)
+		}
+		matched, reason := wgoCmd.matcher().MatchFile(path)
+		normalizedFile, _ := wgoCmd.normalizePath(path)
+		verdict := "skip"
+		if matched {
+			verdict = "match"
+		}
+		fmt.Fprintf(stdout, "%-5s %s (%s)\n", verdict, normalizedFile, reason)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package watcher
+
+import (
+	"testing"
+)
+
+func TestWgoMatch(t *testing.T) {
+	t.Parallel()
+	stdout := &Buffer{}
+	err := WgoMatch([]string{
+		"-file", ".css", "-xdir", "vendor", "-xfile", "_test.go",
+		"styles.css", "vendor/bootstrap.css", "styles_test.go", "main.js",
+	}, stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := stdout.String()
+	want := "match styles.css (matched by -file \\.css)\n" +
+		"skip  vendor/bootstrap.css (excluded by -xdir vendor)\n" +
+		"skip  styles_test.go (excluded by -xfile _test\\.go)\n" +
+		"skip  main.js (not matched by any -file)\n"
+	if got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	err = WgoMatch([]string{"-file", ".css"}, &Buffer{})
+	if err == nil {
+		t.Error("expected an error for no paths")
+	}
+}
@@ -0,0 +1,72 @@
+package watcher
+
+import (
+	"html"
+	"regexp"
+	"sync"
+)
+
+// buildFailure is a failed build (or gate) and what the commands printed, to
+// be shown in the browser as an error overlay.
+type buildFailure struct {
+	Title  string `json:"title"`
+	Output string `json:"output"`
+}
+
+// Error implements the error interface.
+func (failure *buildFailure) Error() string {
+	return failure.Title
+}
+
+// overlayStyle is the CSS of the error overlay, shared by the overlay that the
+// livereload script puts over the page and the overlay page of the proxy.
+const overlayStyle = "position:fixed;top:0;right:0;bottom:0;left:0;z-index:2147483647;overflow:auto;margin:0;padding:2em;" +
+	"background:rgba(0,0,0,0.9);color:#e8e8e8;font:14px/1.5 monospace;white-space:pre-wrap;"
+
+// overlayPage returns the HTML page that shows the failure, for when there is
+// no page to put the overlay over. The snippet (if any) reloads the page once
+// the build is fixed.
+func overlayPage(failure *buildFailure, snippet string) string {
+	return "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" + html.EscapeString(failure.Title) + "</title>\n</head>\n" +
+		"<body>\n<pre style=\"" + overlayStyle + "\"><b style=\"color:#ff6b6b\">" + html.EscapeString(failure.Title) + "</b>\n\n" +
+		html.EscapeString(failure.Output) + "</pre>\n" + snippet + "</body>\n</html>\n"
+}
+
+// maxOutputTail is how much of the output of the commands an outputTail keeps.
+const maxOutputTail = 64 << 10
+
+// ansiEscapeRegexp matches the terminal escape sequences (colors and the like)
+// and bells that would be garbage in the browser.
+var ansiEscapeRegexp = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\a`)
+
+// outputTail is an io.Writer that keeps the last maxOutputTail bytes written
+// to it.
+type outputTail struct {
+	mu sync.Mutex
+	b  []byte
+}
+
+// Write implements io.Writer.
+func (tail *outputTail) Write(p []byte) (n int, err error) {
+	tail.mu.Lock()
+	defer tail.mu.Unlock()
+	tail.b = append(tail.b, p...)
+	if len(tail.b) > maxOutputTail {
+		tail.b = append(tail.b[:0], tail.b[len(tail.b)-maxOutputTail:]...)
+	}
+	return len(p), nil
+}
+
+// Reset forgets everything written so far.
+func (tail *outputTail) Reset() {
+	tail.mu.Lock()
+	defer tail.mu.Unlock()
+	tail.b = tail.b[:0]
+}
+
+// String returns what was written, without terminal escape sequences.
+func (tail *outputTail) String() string {
+	tail.mu.Lock()
+	defer tail.mu.Unlock()
+	return ansiEscapeRegexp.ReplaceAllString(string(tail.b), "")
+}
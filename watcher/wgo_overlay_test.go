@@ -0,0 +1,40 @@
+package watcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutputTail(t *testing.T) {
+	t.Parallel()
+	tail := &outputTail{}
+	tail.Write([]byte("\x1b[31m./main.go:5:2: undefined: foo\x1b[0m\n\a"))
+	want := "./main.go:5:2: undefined: foo\n"
+	if got := tail.String(); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	tail.Reset()
+	tail.Write([]byte(strings.Repeat("a", maxOutputTail)))
+	tail.Write([]byte("bcd"))
+	got := tail.String()
+	if len(got) != maxOutputTail || !strings.HasSuffix(got, "abcd") {
+		t.Errorf("got %d bytes ending in %q, want %d bytes ending in %q", len(got), got[len(got)-4:], maxOutputTail, "abcd")
+	}
+}
+
+func Test_overlayPage(t *testing.T) {
+	t.Parallel()
+	page := overlayPage(&buildFailure{
+		Title:  "go failed: exit status 1",
+		Output: "./main.go:7:12: cannot use <nil> as string",
+	}, "<script></script>")
+	for _, want := range []string{
+		"<title>go failed: exit status 1</title>",
+		"./main.go:7:12: cannot use &lt;nil&gt; as string</pre>",
+		"<script></script></body>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page does not contain %q:\n%s", want, page)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package watcher
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// prefixColors are the SGR parameters of the colors given to the log prefixes
+// of parallel WgoCmds, in order. Red is left for last because it reads like
+// an error.
+var prefixColors = []string{"36", "35", "33", "32", "34", "31"}
+
+// colorize wraps s in the escape sequences for prefixColors[color-1] (wrapping
+// around). If color is zero, s is returned as it is.
+func colorize(s string, color int) string {
+	if color == 0 {
+		return s
+	}
+	return "\x1b[" + prefixColors[(color-1)%len(prefixColors)] + "m" + s + "\x1b[0m"
+}
+
+// logPrefix returns the prefix of the messages of a WgoCmd with the name:
+// "[wgo] " if it has no name, "[wgo NAME] " otherwise. If color is not zero,
+// the prefix is colored.
+func logPrefix(name string, color int) string {
+	if name == "" {
+		return "[wgo] "
+	}
+	return colorize("[wgo "+name+"]", color) + " "
+}
+
+// uniqueNames makes the names unique by numbering all but the first of the
+// names that are the same, like "api", "api-2", "api-3". Empty names are left
+// alone.
+func uniqueNames(names []string) {
+	seen := make(map[string]int)
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; !ok {
+			seen[name] = 1
+			continue
+		}
+		for {
+			seen[name]++
+			candidate := name + "-" + strconv.Itoa(seen[name])
+			if _, ok := seen[candidate]; !ok {
+				names[i] = candidate
+				seen[candidate] = 1
+				break
+			}
+		}
+	}
+}
+
+// prefixWriter is an io.Writer that writes a prefix at the start of every line
+// written to it. Incomplete lines are written out right away (so that prompts
+// still show up) and the rest of the line goes without a prefix. It is not
+// safe for concurrent use, every command gets its own prefixWriters.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  []byte
+	stamp   func() string // If not nil, its result goes before the prefix.
+	midLine bool          // Whether the last write ended in the middle of a line.
+}
+
+// newPrefixWriter returns a prefixWriter that writes to w.
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{w: w, prefix: []byte(prefix)}
+}
+
+// Write implements io.Writer. Each call results in a single write to the
+// underlying writer, so that lines from different prefixWriters are less
+// likely to be interleaved.
+func (pw *prefixWriter) Write(p []byte) (n int, err error) {
+	buf := make([]byte, 0, len(p)+len(pw.prefix))
+	for rest := p; len(rest) > 0; {
+		if !pw.midLine {
+			if pw.stamp != nil {
+				buf = append(buf, pw.stamp()...)
+			}
+			buf = append(buf, pw.prefix...)
+		}
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			buf = append(buf, rest...)
+			pw.midLine = true
+			break
+		}
+		buf = append(buf, rest[:i+1]...)
+		pw.midLine = false
+		rest = rest[i+1:]
+	}
+	_, err = pw.w.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,54 @@
+package watcher
+
+import "testing"
+
+func Test_logPrefix(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		color int
+		want  string
+	}{
+		{"", 0, "[wgo] "},
+		{"", 3, "[wgo] "},
+		{"api", 0, "[wgo api] "},
+		{"api", 1, "\x1b[36m[wgo api]\x1b[0m "},
+		{"api", 7, "\x1b[36m[wgo api]\x1b[0m "},
+	}
+	for _, tt := range tests {
+		got := logPrefix(tt.name, tt.color)
+		if got != tt.want {
+			t.Errorf("logPrefix(%q, %d) = %q, want %q", tt.name, tt.color, got, tt.want)
+		}
+	}
+}
+
+func Test_uniqueNames(t *testing.T) {
+	t.Parallel()
+	names := []string{"api", "", "api-2", "api", "web", "api", "web"}
+	uniqueNames(names)
+	want := []string{"api", "", "api-2", "api-3", "web", "api-4", "web-2"}
+	if diff := Diff(names, want); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_prefixWriter(t *testing.T) {
+	t.Parallel()
+	buf := &Buffer{}
+	pw := newPrefixWriter(buf, "[api] ")
+	for _, s := range []string{"listening on :8080\nGET /", " 200\n", "", "\n", "Password: "} {
+		n, err := pw.Write([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(s) {
+			t.Errorf("Write(%q) = %d, want %d", s, n, len(s))
+		}
+	}
+	got := buf.String()
+	want := "[api] listening on :8080\n[api] GET / 200\n[api] \n[api] Password: "
+	if got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
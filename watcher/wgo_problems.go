@@ -0,0 +1,138 @@
+package watcher
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// problemRegexp matches the file:line[:col]: prefix of the errors printed by
+// the go tool, the compiler, go vet and go test, such as "./main.go:5:2:
+// undefined: foo" or "    main_test.go:12: got 1, want 2".
+var problemRegexp = regexp.MustCompile(`^\s*(.+?\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+// problem is the location and message of an error in the output of a command.
+type problem struct {
+	file    string // The absolute path of the file.
+	line    string
+	col     string // Defaults to "1" if the tool didn't print a column.
+	message string
+}
+
+// parseProblem parses the error in a line of output, resolving its file
+// relative to dir (the directory that the command ran in). It returns false
+// for lines that aren't errors, or whose file doesn't exist relative to dir
+// (such as the tests of another package).
+func parseProblem(line []byte, dir string) (problem, bool) {
+	match := problemRegexp.FindSubmatch(bytes.TrimRight(line, "\r\n"))
+	if match == nil {
+		return problem{}, false
+	}
+	file := string(match[1])
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return problem{}, false
+	}
+	if _, err := os.Stat(file); err != nil {
+		return problem{}, false
+	}
+	p := problem{file: file, line: string(match[2]), col: string(match[3]), message: string(match[4])}
+	if p.col == "" {
+		p.col = "1"
+	}
+	return p, true
+}
+
+// problemLine rewrites the location of an error in a line of output to an
+// absolute file:line:col: prefix, so that VS Code's $go problem matcher finds
+// the file no matter which directory the command ran in. Lines that
+// parseProblem doesn't understand are returned as they are.
+func problemLine(line []byte, dir string) []byte {
+	p, ok := parseProblem(line, dir)
+	if !ok {
+		return line
+	}
+	b := make([]byte, 0, len(p.file)+len(line)+2)
+	b = append(b, p.file+":"+p.line+":"+p.col+": "+p.message...)
+	return append(b, line[len(bytes.TrimRight(line, "\r\n")):]...)
+}
+
+// problemWriter is an io.Writer that rewrites the errors in the output of a
+// command with problemLine. Like prefixWriter, incomplete lines are written
+// out right away and the rest of the line is left alone. It is not safe for
+// concurrent use, every command gets its own problemWriters.
+type problemWriter struct {
+	w       io.Writer
+	dir     string // The directory that the command runs in.
+	midLine bool   // Whether the last write ended in the middle of a line.
+}
+
+// Write implements io.Writer. Each call results in a single write to the
+// underlying writer.
+func (pw *problemWriter) Write(p []byte) (n int, err error) {
+	buf := make([]byte, 0, len(p))
+	for rest := p; len(rest) > 0; {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			buf = append(buf, rest...)
+			pw.midLine = true
+			break
+		}
+		if pw.midLine {
+			buf = append(buf, rest[:i+1]...)
+		} else {
+			buf = append(buf, problemLine(rest[:i+1], pw.dir)...)
+		}
+		pw.midLine = false
+		rest = rest[i+1:]
+	}
+	_, err = pw.w.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// githubAnnotations returns the ::error workflow commands that annotate the
+// errors in the output of a failed build for GitHub Actions, with file paths
+// relative to the current directory (the root of the repository). If no error
+// in the output has a location, a single annotation with the title is
+// returned instead.
+func githubAnnotations(output, dir, title string) string {
+	cwd, _ := os.Getwd()
+	var b strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		p, ok := parseProblem([]byte(line), dir)
+		if !ok {
+			continue
+		}
+		file := p.file
+		if rel, err := filepath.Rel(cwd, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+		b.WriteString("::error file=" + escapeWorkflowProperty(filepath.ToSlash(file)) +
+			",line=" + p.line + ",col=" + p.col + ",title=" + escapeWorkflowProperty(title) +
+			"::" + escapeWorkflowData(p.message) + "\n")
+	}
+	if b.Len() == 0 {
+		return "::error::" + escapeWorkflowData(title) + "\n"
+	}
+	return b.String()
+}
+
+// escapeWorkflowData escapes the message of a GitHub Actions workflow command.
+func escapeWorkflowData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeWorkflowProperty escapes a property (such as file=) of a GitHub
+// Actions workflow command.
+func escapeWorkflowProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,238 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_problemLine(t *testing.T) {
+	t.Parallel()
+	dir, err := filepath.Abs("testdata/args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainGo := filepath.Join(dir, "main.go")
+	tests := []struct {
+		description string
+		line        string
+		dir         string
+		want        string
+	}{{
+		description: "compiler error",
+		line:        "./main.go:5:2: undefined: foo\n",
+		dir:         "testdata/args",
+		want:        mainGo + ":5:2: undefined: foo\n",
+	}, {
+		description: "no column",
+		line:        "    main.go:12: got 1, want 2\r\n",
+		dir:         "testdata/args",
+		want:        mainGo + ":12:1: got 1, want 2\r\n",
+	}, {
+		description: "relative to the current directory",
+		line:        "testdata/args/main.go:7:13: missing return\n",
+		dir:         "",
+		want:        mainGo + ":7:13: missing return\n",
+	}, {
+		description: "absolute",
+		line:        mainGo + ":3:1: syntax error\n",
+		dir:         "testdata/file_event",
+		want:        mainGo + ":3:1: syntax error\n",
+	}, {
+		description: "file of another package",
+		line:        "    wgo_cmd_test.go:12: got 1, want 2\n",
+		dir:         "testdata/args",
+		want:        "    wgo_cmd_test.go:12: got 1, want 2\n",
+	}, {
+		description: "not an error",
+		line:        "# github.com/bokwoon95/wgo/watcher/testdata/args\n",
+		dir:         "testdata/args",
+		want:        "# github.com/bokwoon95/wgo/watcher/testdata/args\n",
+	}}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.description, func(t *testing.T) {
+			t.Parallel()
+			got := string(problemLine([]byte(tt.line), tt.dir))
+			if got != tt.want {
+				t.Errorf("\ngot:  %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_problemWriter(t *testing.T) {
+	t.Parallel()
+	mainGo, err := filepath.Abs("testdata/args/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &Buffer{}
+	pw := &problemWriter{w: buf, dir: "testdata/args"}
+	for _, s := range []string{"# example\n./main.go:5:2: undefined: foo\n./main", ".go:6:2: undefined: bar\n", "./main.go:7:2: undefined: baz\n"} {
+		n, err := pw.Write([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(s) {
+			t.Errorf("Write(%q) = %d, want %d", s, n, len(s))
+		}
+	}
+	got := buf.String()
+	want := "# example\n" +
+		mainGo + ":5:2: undefined: foo\n" +
+		"./main.go:6:2: undefined: bar\n" +
+		mainGo + ":7:2: undefined: baz\n"
+	if got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestWgoCmd_FailureFormat(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wgoCmd, err := WgoCommand(ctx, []string{"-failure-format", "vscode", "-quiet", "go", "nonexistent", "::", "go", "run", "./testdata/args", "apple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := &Buffer{}
+	wgoCmd.Stdout = &Buffer{}
+	wgoCmd.Stderr = stderr
+	failures := make(chan error, 1)
+	wgoCmd.OnBuildFailure = func(err error, output string) {
+		failures <- err
+	}
+	cmdResult := make(chan error)
+	go func() {
+		cmdResult <- wgoCmd.Run()
+	}()
+	select {
+	case <-failures:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the build failure")
+	}
+	cancel()
+	err = <-cmdResult
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := stderr.String()
+	if !strings.HasPrefix(got, "[wgo] BUILD START\n") {
+		t.Errorf("output %q does not start with the BUILD START marker", got)
+	}
+	if !strings.HasSuffix(got, "[wgo] BUILD FAILED: go failed: exit status 2\n") {
+		t.Errorf("output %q does not end with the BUILD FAILED marker", got)
+	}
+}
+
+func Test_githubAnnotations(t *testing.T) {
+	t.Parallel()
+	output := "# github.com/bokwoon95/wgo/watcher/testdata/args\n" +
+		"./main.go:5:2: undefined: foo\n" +
+		"./main.go:9: 100% wrong, really\n" +
+		"./nonexistent.go:1:1: expected 'package', found 'EOF'\n"
+	got := githubAnnotations(output, "testdata/args", "go failed: exit status 1")
+	want := "::error file=testdata/args/main.go,line=5,col=2,title=go failed%3A exit status 1::undefined: foo\n" +
+		"::error file=testdata/args/main.go,line=9,col=1,title=go failed%3A exit status 1::100%25 wrong, really\n"
+	if got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	got = githubAnnotations("go: unknown command\n", "", "go failed: exit status 2")
+	want = "::error::go failed: exit status 2\n"
+	if got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestWgoCmd_CI(t *testing.T) {
+	t.Parallel()
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+		wgoCmd, err := WgoCommand(context.Background(), []string{"-ci", "go", "run", "./testdata/args", "apple", "::", "go", "run", "./testdata/args", "banana"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !wgoCmd.Exit || wgoCmd.FailureFormat != "github" {
+			t.Errorf("-ci: expected Exit and FailureFormat github, got %v and %q", wgoCmd.Exit, wgoCmd.FailureFormat)
+		}
+		stdout := &Buffer{}
+		wgoCmd.Stdout = stdout
+		wgoCmd.Stderr = &Buffer{}
+		err = wgoCmd.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := stdout.String()
+		want := "::group::go run ./testdata/args apple\n" +
+			"[apple]\n" +
+			"::endgroup::\n" +
+			"::group::go run ./testdata/args banana\n" +
+			"[banana]\n" +
+			"::endgroup::\n"
+		if got != want {
+			t.Errorf("\ngot:  %q\nwant: %q", got, want)
+		}
+	})
+	t.Run("failure", func(t *testing.T) {
+		t.Parallel()
+		wgoCmd, err := WgoCommand(context.Background(), []string{"-ci", "go", "nonexistent", "::", "go", "run", "./testdata/args", "apple"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout := &Buffer{}
+		wgoCmd.Stdout = stdout
+		wgoCmd.Stderr = &Buffer{}
+		// A failed build doesn't wait for file changes, Run returns right
+		// away.
+		err = wgoCmd.Run()
+		var buildErr *BuildFailedError
+		if !errors.As(err, &buildErr) {
+			t.Fatalf("expected a *BuildFailedError, got %#v", err)
+		}
+		got := stdout.String()
+		want := "::group::go nonexistent\n" +
+			"::endgroup::\n" +
+			"::error::go failed: exit status 2\n"
+		if got != want {
+			t.Errorf("\ngot:  %q\nwant: %q", got, want)
+		}
+	})
+	t.Run("per-command -cd", func(t *testing.T) {
+		t.Parallel()
+		tmpDir := t.TempDir()
+		for name, content := range map[string]string{
+			"go.mod":  "module example.com/broken\n\ngo 1.16\n",
+			"main.go": "package main\n\nfunc main() {\n\tfoo()\n}\n",
+		} {
+			err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		wgoCmd, err := WgoCommand(context.Background(), []string{"-ci", "go", "run", "./testdata/args", "apple", "::", "-cd", tmpDir, "go", "build", "-o", filepath.Join(tmpDir, "app"), "."})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout := &Buffer{}
+		wgoCmd.Stdout = stdout
+		wgoCmd.Stderr = &Buffer{}
+		err = wgoCmd.Run()
+		var buildErr *BuildFailedError
+		if !errors.As(err, &buildErr) {
+			t.Fatalf("expected a *BuildFailedError, got %#v", err)
+		}
+		// The file of the annotation is relative to the -cd of the go build,
+		// not to the directory of wgo.
+		got := stdout.String()
+		want := "::error file=" + escapeWorkflowProperty(filepath.ToSlash(filepath.Join(tmpDir, "main.go"))) +
+			",line=4,col=2,title=go failed%3A exit status 1::undefined: foo\n"
+		if !strings.HasSuffix(got, want) {
+			t.Errorf("output %q does not end with %q", got, want)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// devProxy is a reverse proxy to the server being developed. While the server
+// is restarting it holds on to incoming requests and only forwards them once
+// the server is ready, so that the browser doesn't see "connection refused".
+type devProxy struct {
+	timeout time.Duration // How long a request may wait for the server.
+	proxy   *httputil.ReverseProxy
+	snippet string // Injected into every HTML page, if not empty.
+
+	mu    sync.Mutex
+	ready chan struct{} // Closed once the server is ready (or failed).
+	err   error         // Why the server failed to become ready, if it did.
+}
+
+// newDevProxy returns a devProxy to the target address (e.g. localhost:8080 or
+// http://localhost:8080). The server counts as restarting until the first call
+// to release.
+func newDevProxy(target string, timeout time.Duration) (*devProxy, error) {
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if targetURL.Host == "" {
+		return nil, errors.New("no host in " + target)
+	}
+	p := &devProxy{
+		timeout: timeout,
+		proxy:   httputil.NewSingleHostReverseProxy(targetURL),
+		ready:   make(chan struct{}),
+	}
+	// Even once the server counts as ready, it may not be listening yet (if
+	// there is no -ready-url), so keep trying to connect until it is. Any
+	// error counts, because "connection refused" looks different on every
+	// OS.
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+		for {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err == nil {
+				return conn, nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil, err
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+	p.proxy.Transport = transport
+	director := p.proxy.Director
+	p.proxy.Director = func(r *http.Request) {
+		director(r)
+		// Let the transport ask for a gzipped response, so that it
+		// decompresses it before the snippet is injected. Other encodings
+		// can't be decompressed.
+		if p.snippet != "" {
+			r.Header.Del("Accept-Encoding")
+		}
+	}
+	p.proxy.ModifyResponse = p.injectSnippet
+	return p, nil
+}
+
+// injectSnippet adds the snippet to the end of the body of the HTML response.
+func (p *devProxy) injectSnippet(resp *http.Response) error {
+	if p.snippet == "" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return nil
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	body = injectBeforeBodyEnd(body, p.snippet)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	// The page is no longer what the server sent, so it must not be
+	// validated against what the server sent either.
+	resp.Header.Del("ETag")
+	return nil
+}
+
+// injectBeforeBodyEnd inserts the snippet before the closing </body> tag of the
+// HTML, or appends it if there is none.
+func injectBeforeBodyEnd(html []byte, snippet string) []byte {
+	i := bytes.LastIndex(bytes.ToLower(html), []byte("</body"))
+	if i < 0 {
+		return append(html, snippet...)
+	}
+	b := make([]byte, 0, len(html)+len(snippet))
+	b = append(b, html[:i]...)
+	b = append(b, snippet...)
+	return append(b, html[i:]...)
+}
+
+// hold makes new requests wait until the next call to release, because the
+// server is about to restart.
+func (p *devProxy) hold() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.ready:
+		p.ready = make(chan struct{})
+		p.err = nil
+	default: // Already holding.
+	}
+}
+
+// release forwards the waiting requests to the server, or fails them (and the
+// requests that arrive until the next restart) with err if the server failed
+// to restart.
+func (p *devProxy) release(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.ready: // Not holding, the server that is running is fine.
+	default:
+		p.err = err
+		close(p.ready)
+	}
+}
+
+// ServeHTTP forwards the request to the server once it is ready.
+func (p *devProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	ready := p.ready
+	p.mu.Unlock()
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	select {
+	case <-r.Context().Done():
+		return
+	case <-timer.C:
+		http.Error(w, "[wgo] the server did not restart within "+p.timeout.String(), http.StatusGatewayTimeout)
+		return
+	case <-ready:
+	}
+	p.mu.Lock()
+	err := p.err
+	p.mu.Unlock()
+	var failure *buildFailure
+	if errors.As(err, &failure) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, overlayPage(failure, p.snippet))
+		return
+	}
+	if err != nil {
+		http.Error(w, "[wgo] "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	p.proxy.ServeHTTP(w, r)
+}
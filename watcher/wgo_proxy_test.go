@@ -0,0 +1,154 @@
+package watcher
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDevProxy(t *testing.T) {
+	t.Parallel()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello "+r.URL.Path)
+	}))
+	defer backend.Close()
+	proxy, err := newDevProxy(backend.URL, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	get := func() (int, string) {
+		resp, err := http.Get(server.URL + "/world")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(b)
+	}
+	type response struct {
+		code int
+		body string
+	}
+
+	// The request is held until the server is released.
+	responses := make(chan response, 1)
+	go func() {
+		code, body := get()
+		responses <- response{code, body}
+	}()
+	select {
+	case resp := <-responses:
+		t.Fatalf("request was not held: got %d %q", resp.code, resp.body)
+	case <-time.After(200 * time.Millisecond):
+	}
+	proxy.release(nil)
+	resp := <-responses
+	if resp.code != http.StatusOK || resp.body != "hello /world" {
+		t.Errorf("got %d %q, want %d %q", resp.code, resp.body, http.StatusOK, "hello /world")
+	}
+
+	// A failed restart fails the requests until the next restart.
+	proxy.hold()
+	proxy.release(errors.New("main.go failed: exit status 1"))
+	code, body := get()
+	want := "[wgo] main.go failed: exit status 1\n"
+	if code != http.StatusBadGateway || body != want {
+		t.Errorf("got %d %q, want %d %q", code, body, http.StatusBadGateway, want)
+	}
+
+	// A failed build is shown as an error overlay.
+	proxy.hold()
+	proxy.release(&buildFailure{Title: "go failed: exit status 1", Output: "./main.go:5:2: undefined: foo"})
+	code, body = get()
+	if code != http.StatusBadGateway || !strings.Contains(body, "./main.go:5:2: undefined: foo</pre>") {
+		t.Errorf("got %d %q, want %d and the error overlay", code, body, http.StatusBadGateway)
+	}
+
+	// Releasing a server that is not being held changes nothing.
+	proxy.hold()
+	proxy.release(nil)
+	proxy.release(errors.New("ignored"))
+	code, body = get()
+	if code != http.StatusOK || body != "hello /world" {
+		t.Errorf("got %d %q, want %d %q", code, body, http.StatusOK, "hello /world")
+	}
+}
+
+func TestDevProxy_injectSnippet(t *testing.T) {
+	t.Parallel()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("ETag", `"abc"`)
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				io.WriteString(w, "<html><BODY>hello</BODY></html>")
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			gzipWriter := gzip.NewWriter(w)
+			io.WriteString(gzipWriter, "<html><BODY>hello</BODY></html>")
+			gzipWriter.Close()
+		case "/fragment.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, "<p>hello</p>")
+		default:
+			w.Header().Set("Content-Type", "text/css")
+			io.WriteString(w, "body{}</body>")
+		}
+	}))
+	defer backend.Close()
+	proxy, err := newDevProxy(backend.URL, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.snippet = "<script></script>"
+	proxy.release(nil)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/index.html", "<html><BODY>hello<script></script></BODY></html>"},
+		{"/fragment.html", "<p>hello</p><script></script>"},
+		{"/style.css", "body{}</body>"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", server.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(b); got != tt.want {
+			t.Errorf("%s\ngot:  %q\nwant: %q", tt.path, got, tt.want)
+		}
+		if resp.ContentLength != int64(len(tt.want)) {
+			t.Errorf("%s: Content-Length is %d, want %d", tt.path, resp.ContentLength, len(tt.want))
+		}
+		if strings.HasSuffix(tt.path, ".html") && resp.Header.Get("ETag") != "" {
+			t.Errorf("%s: ETag %q was not removed", tt.path, resp.Header.Get("ETag"))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package watcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// recordedEvent is a line of a -record file: a file event and when it
+// happened, in seconds since the wgo command started. File is relative to the
+// first root directory (with forward slashes) if it is inside it, so that the
+// recording can be replayed on another machine.
+type recordedEvent struct {
+	Elapsed float64 `json:"elapsed"`
+	Name    string  `json:"name,omitempty"`
+	Op      string  `json:"op"`
+	File    string  `json:"file"`
+}
+
+// recordFile is a -record file. The parallel wgo commands that record to the
+// same path share a recordFile, so that the file is only truncated once and
+// every command's events end up in it.
+type recordFile struct {
+	mu    sync.Mutex
+	path  string
+	file  *os.File
+	users int // The number of eventRecorders that have the file open.
+}
+
+// open creates (or truncates) the file if it isn't open yet.
+func (f *recordFile) open() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0666)
+		if err != nil {
+			return err
+		}
+		f.file = file
+	}
+	f.users++
+	return nil
+}
+
+// write writes a line to the file.
+func (f *recordFile) write(line []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		_, _ = f.file.Write(line)
+	}
+}
+
+// close closes the file once its last user is done with it.
+func (f *recordFile) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users--
+	if f.users > 0 || f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// eventRecorder writes every file event that a wgo command receives to a
+// -record file.
+type eventRecorder struct {
+	file  *recordFile
+	name  string
+	root  string
+	start time.Time
+}
+
+// newEventRecorder opens the -record file, creating (or truncating) it unless
+// another wgo command already has it open. The events are recorded under the
+// name of the wgo command and relative to root. It must be closed once it is
+// no longer needed.
+func newEventRecorder(file *recordFile, name, root string) (*eventRecorder, error) {
+	err := file.open()
+	if err != nil {
+		return nil, err
+	}
+	return &eventRecorder{
+		file:  file,
+		name:  name,
+		root:  root,
+		start: time.Now(),
+	}, nil
+}
+
+// record writes the event to the file.
+func (recorder *eventRecorder) record(event fsnotify.Event) {
+	file := filepath.ToSlash(event.Name)
+	if rel, err := filepath.Rel(recorder.root, event.Name); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		file = filepath.ToSlash(rel)
+	}
+	b, err := json.Marshal(recordedEvent{
+		Elapsed: time.Since(recorder.start).Seconds(),
+		Name:    recorder.name,
+		Op:      event.Op.String(),
+		File:    file,
+	})
+	if err != nil {
+		return
+	}
+	recorder.file.write(append(b, '\n'))
+}
+
+// Close closes the file (see recordFile.close).
+func (recorder *eventRecorder) Close() error {
+	return recorder.file.close()
+}
+
+// readRecording reads the events of a -record file, for `wgo replay`.
+func readRecording(path string) ([]recordedEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var events []recordedEvent
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var event recordedEvent
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// fsnotifyOps maps the names of the operations of a recorded event back to
+// their fsnotify.Op.
+var fsnotifyOps = map[string]fsnotify.Op{
+	"CREATE": fsnotify.Create,
+	"WRITE":  fsnotify.Write,
+	"REMOVE": fsnotify.Remove,
+	"RENAME": fsnotify.Rename,
+	"CHMOD":  fsnotify.Chmod,
+}
+
+// fsnotifyEvent returns the fsnotify.Event of a recorded event, with its file
+// relative to root.
+func (event recordedEvent) fsnotifyEvent(root string) fsnotify.Event {
+	var op fsnotify.Op
+	for _, name := range strings.Split(event.Op, "|") {
+		op |= fsnotifyOps[name]
+	}
+	name := filepath.FromSlash(event.File)
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(root, name)
+	}
+	return fsnotify.Event{Name: name, Op: op}
+}
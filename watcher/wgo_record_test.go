@@ -0,0 +1,129 @@
+package watcher
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func Test_eventRecorder(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	file := filepath.Join(t.TempDir(), "events.log")
+	recorder, err := newEventRecorder(&recordFile{path: file}, "api", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside, err := filepath.Abs("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.record(fsnotify.Event{Name: filepath.Join(root, "internal", "foo.go"), Op: fsnotify.Create | fsnotify.Write})
+	recorder.record(fsnotify.Event{Name: outside, Op: fsnotify.Remove})
+	recorder.Close()
+	events, err := readRecording(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if got := events[0]; got.Name != "api" || got.Op != "CREATE|WRITE" || got.File != "internal/foo.go" || got.Elapsed < 0 {
+		t.Errorf("unexpected event: %#v", got)
+	}
+	if got, want := events[1].File, filepath.ToSlash(outside); got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	// Replaying the events elsewhere moves the files under the new root.
+	newRoot := t.TempDir()
+	want := []fsnotify.Event{
+		{Name: filepath.Join(newRoot, "internal", "foo.go"), Op: fsnotify.Create | fsnotify.Write},
+		{Name: outside, Op: fsnotify.Remove},
+	}
+	for i, event := range events {
+		if diff := Diff(event.fsnotifyEvent(newRoot), want[i]); diff != "" {
+			t.Error(diff)
+		}
+	}
+}
+
+func Test_recordFile(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	file := filepath.Join(t.TempDir(), "events.log")
+	wgoCmds, err := WgoCommands(context.Background(), []string{
+		"wgo", "-record", file, "-name", "api", "echo", "api", "::",
+		"wgo", "-record", file, "-name", "web", "echo", "web",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wgoCmds[0].recFile == nil || wgoCmds[0].recFile != wgoCmds[1].recFile {
+		t.Fatalf("-record files are not shared: %p, %p", wgoCmds[0].recFile, wgoCmds[1].recFile)
+	}
+	// The second recorder must not truncate the events of the first one.
+	api, err := newEventRecorder(wgoCmds[0].recFile, "api", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.record(fsnotify.Event{Name: filepath.Join(root, "api.go"), Op: fsnotify.Write})
+	web, err := newEventRecorder(wgoCmds[1].recFile, "web", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web.record(fsnotify.Event{Name: filepath.Join(root, "web.go"), Op: fsnotify.Write})
+	api.Close()
+	web.record(fsnotify.Event{Name: filepath.Join(root, "index.html"), Op: fsnotify.Write})
+	web.Close()
+	events, err := readRecording(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Name+" "+event.File)
+	}
+	want := []string{"api api.go", "web web.go", "web index.html"}
+	if diff := Diff(got, want); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wgoCmd, err := WgoCommand(ctx, []string{"-file", "\\.go$", "go", "run", "./testdata/args", "apple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &Buffer{}
+	stderr := &Buffer{}
+	wgoCmd.Stdout = buf
+	wgoCmd.Stderr = stderr
+	wgoCmd.replay = []recordedEvent{
+		{Elapsed: 1, Op: "WRITE", File: "README.md"},
+		{Elapsed: 1.5, Op: "WRITE", File: "wgo_record.go"},
+		{Elapsed: 1.5, Name: "other", Op: "WRITE", File: "main.go"},
+	}
+	cmdResult := make(chan error)
+	go func() {
+		cmdResult <- wgoCmd.Run()
+	}()
+	time.Sleep(4 * time.Second)
+	cancel()
+	err = <-cmdResult
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(buf.String()), "[apple]\n[apple]"; got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	if got, want := stderr.String(), "[wgo] replay: replayed 2 file events\n"; got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+}
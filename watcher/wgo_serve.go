@@ -0,0 +1,210 @@
+package watcher
+
+import (
+	"bytes"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// serveReloadPrefix is where `wgo serve` serves its livereload endpoints, out
+// of the way of the files being served.
+const serveReloadPrefix = "/_wgo"
+
+// WgoServe implements the `wgo serve` command, which serves the files in a
+// directory over HTTP (or HTTPS) and reloads the browsers viewing them whenever
+// a file in the directory changes. The args should not include the leading
+// "wgo serve".
+func WgoServe(args []string, stdout io.Writer) error {
+	var addr, certFile, keyFile string
+	var liveReload, useTLS bool
+	flagset := flag.NewFlagSet("", flag.ContinueOnError)
+	flagset.StringVar(&addr, "listen", "localhost:8080", "The address to serve the files on.")
+	flagset.BoolVar(&liveReload, "livereload", true, "Reload the HTML pages being viewed when a file changes.")
+	flagset.BoolVar(&useTLS, "tls", false, "Serve the files over HTTPS.")
+	flagset.StringVar(&certFile, "tls-cert", "", "The certificate file for -tls. Defaults to a self-signed certificate for localhost.")
+	flagset.StringVar(&keyFile, "tls-key", "", "The private key file for -tls-cert.")
+	flagset.Usage = func() {
+		fmt.Fprint(flagset.Output(), `Usage:
+  wgo serve [FLAGS] [DIR]
+  wgo serve ./public
+  wgo serve -listen :3000 ./dist
+  wgo serve -tls -tls-cert localhost.pem -tls-key localhost-key.pem ./public
+  wgo -file .css npx tailwindcss -o ./public/style.css :: wgo serve ./public
+Flags:
+`)
+		flagset.PrintDefaults()
+	}
+	err := flagset.Parse(args)
+	if err != nil {
+		return err
+	}
+	dir := "."
+	switch flagset.NArg() {
+	case 0:
+	case 1:
+		dir = flagset.Arg(0)
+	default:
+		flagset.Usage()
+		return fmt.Errorf("wgo serve: only one directory can be served")
+	}
+	fileInfo, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("wgo serve: %w", err)
+	}
+	if !fileInfo.IsDir() {
+		return fmt.Errorf("wgo serve: %s is not a directory", dir)
+	}
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf("wgo serve: -tls-cert and -tls-key must be used together")
+	}
+	scheme := "http"
+	var config *tls.Config
+	if useTLS || certFile != "" {
+		scheme = "https"
+		config, err = tlsConfig(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("wgo serve: -tls: %w", err)
+		}
+	}
+	srv := newStaticServer(dir, liveReload)
+	if liveReload {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("wgo serve: %w", err)
+		}
+		defer watcher.Close()
+		go srv.watch(watcher)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("wgo serve: %w", err)
+	}
+	if config != nil {
+		ln = tls.NewListener(ln, config)
+	}
+	fmt.Fprintf(stdout, "[wgo] serving %s on %s://%s\n", dir, scheme, ln.Addr().String())
+	return http.Serve(ln, srv)
+}
+
+// staticServer serves the files in a directory. If it has a livereload server,
+// the livereload script is injected into every HTML page.
+type staticServer struct {
+	dir        string
+	fileServer http.Handler
+	reloader   *liveReload
+}
+
+// newStaticServer returns a staticServer for the files in dir.
+func newStaticServer(dir string, liveReload bool) *staticServer {
+	srv := &staticServer{
+		dir:        dir,
+		fileServer: http.FileServer(http.Dir(dir)),
+	}
+	if liveReload {
+		srv.reloader = newLiveReload()
+	}
+	return srv
+}
+
+// ServeHTTP serves the file at the request path.
+func (srv *staticServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if srv.reloader != nil && strings.HasPrefix(r.URL.Path, serveReloadPrefix+"/") {
+		http.StripPrefix(serveReloadPrefix, srv.reloader).ServeHTTP(w, r)
+		return
+	}
+	// The files change all the time during development, so make the browser
+	// check for a newer version every time. Files that didn't change are
+	// still not downloaded again, thanks to Last-Modified.
+	w.Header().Set("Cache-Control", "no-cache")
+	if srv.reloader == nil {
+		srv.fileServer.ServeHTTP(w, r)
+		return
+	}
+	name := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	} else if strings.HasSuffix(name, "/index.html") {
+		// Let the file server redirect it to the directory.
+		srv.fileServer.ServeHTTP(w, r)
+		return
+	}
+	if path.Ext(name) != ".html" && path.Ext(name) != ".htm" {
+		srv.fileServer.ServeHTTP(w, r)
+		return
+	}
+	file, err := http.Dir(srv.dir).Open(name)
+	if err != nil {
+		srv.fileServer.ServeHTTP(w, r)
+		return
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil || fileInfo.IsDir() {
+		srv.fileServer.ServeHTTP(w, r)
+		return
+	}
+	b, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b = injectBeforeBodyEnd(b, `<script src="`+serveReloadPrefix+`/livereload.js"></script>`+"\n")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, name, fileInfo.ModTime(), bytes.NewReader(b))
+}
+
+// watch reloads the browsers whenever a file in the directory changes. Like
+// WgoCmd, it waits for the file events to settle down before reloading.
+func (srv *staticServer) watch(watcher *fsnotify.Watcher) {
+	srv.addDirsRecursively(watcher, srv.dir)
+	timer := time.NewTimer(0)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) {
+				fileInfo, err := os.Stat(event.Name)
+				if err == nil && fileInfo.IsDir() {
+					srv.addDirsRecursively(watcher, event.Name)
+				}
+			}
+			if strings.HasPrefix(filepath.Base(event.Name), ".") {
+				continue // Editor swap files and the like.
+			}
+			timer.Reset(300 * time.Millisecond)
+		case <-watcher.Errors:
+		case <-timer.C:
+			srv.reloader.reload()
+		}
+	}
+}
+
+// addDirsRecursively adds dir and its subdirectories to the watcher, skipping
+// hidden directories.
+func (srv *staticServer) addDirsRecursively(watcher *fsnotify.Watcher, dir string) {
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		watcher.Add(path)
+		return nil
+	})
+}
@@ -0,0 +1,108 @@
+package watcher
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestStaticServer(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":     "<html><body>home</body></html>",
+		"about.html":     "<p>about</p>",
+		"style.css":      "body{}",
+		"docs/index.htm": "not an index",
+	}
+	for name, content := range files {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := newStaticServer(dir, true)
+	server := httptest.NewServer(srv)
+	defer server.Close()
+
+	const script = `<script src="/_wgo/livereload.js"></script>` + "\n"
+	tests := []struct {
+		path        string
+		code        int
+		body        string
+		contentType string
+	}{
+		{"/", http.StatusOK, "<html><body>home" + script + "</body></html>", "text/html; charset=utf-8"},
+		{"/about.html", http.StatusOK, "<p>about</p>" + script, "text/html; charset=utf-8"},
+		{"/style.css", http.StatusOK, "body{}", "text/css; charset=utf-8"},
+		{"/docs/index.htm", http.StatusOK, "not an index" + script, "text/html; charset=utf-8"},
+		{"/missing.html", http.StatusNotFound, "404 page not found\n", "text/plain; charset=utf-8"},
+		{"/_wgo/livereload.js", http.StatusOK, liveReloadScript, "text/javascript; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.code {
+			t.Errorf("%s: got status %d, want %d", tt.path, resp.StatusCode, tt.code)
+		}
+		if got := string(b); got != tt.body {
+			t.Errorf("%s\ngot:  %q\nwant: %q", tt.path, got, tt.body)
+		}
+		if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: Content-Type is %q, want %q", tt.path, got, tt.contentType)
+		}
+		if tt.path != "/_wgo/livereload.js" && resp.Header.Get("Cache-Control") != "no-cache" {
+			t.Errorf("%s: Cache-Control is %q, want no-cache", tt.path, resp.Header.Get("Cache-Control"))
+		}
+	}
+
+	// A changed file reloads the browser.
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	resp, err := http.Get(server.URL + "/_wgo/livereload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || line != ": connected\n" {
+		t.Fatalf("got %q, %v, want %q", line, err, ": connected\n")
+	}
+	srv.addDirsRecursively(watcher, dir)
+	go srv.watch(watcher)
+	err = os.WriteFile(filepath.Join(dir, "docs", "style.css"), []byte("p{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, "event: reload") {
+			break
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package watcher
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func Test_loadOrCreateCertificate(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "localhost.pem")
+	keyFile := filepath.Join(dir, "localhost-key.pem")
+	cert, err := loadOrCreateCertificate(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = leaf.VerifyHostname("localhost")
+	if err != nil {
+		t.Error(err)
+	}
+	if !leaf.IPAddresses[0].Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("got IP address %s, want 127.0.0.1", leaf.IPAddresses[0])
+	}
+
+	// The certificate is kept, so that the browser keeps trusting it.
+	reloaded, err := loadOrCreateCertificate(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reloaded.Certificate[0], cert.Certificate[0]) {
+		t.Error("a new certificate was generated instead of loading the existing one")
+	}
+
+	// The servers speak HTTP/2 over TLS.
+	config, err := tlsConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.Listener = tls.NewListener(server.Listener, config)
+	server.Start()
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Proto != "HTTP/2.0" {
+		t.Errorf("got %s, want HTTP/2.0", resp.Proto)
+	}
+}
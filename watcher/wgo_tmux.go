@@ -0,0 +1,86 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// tmuxEnv is set in the environment of the wgo commands started in tmux panes
+// by -tmux, so that they know not to start yet another tmux layout.
+const tmuxEnv = "WGO_TMUX"
+
+// startTmux runs each parallel wgo command in args (os.Args) in its own tmux
+// pane. If wgo is already running inside tmux, the panes are created in a new
+// window. Otherwise they are created in a new tmux session, which wgo then
+// attaches to.
+func startTmux(args []string) error {
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("-tmux is not supported on Windows")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("-tmux: %w", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("-tmux: %w", err)
+	}
+	name := "wgo-" + strconv.Itoa(os.Getpid())
+	inside := os.Getenv("TMUX") != ""
+	cmd := exec.Command("tmux", tmuxArgs(splitWgoArgs(args), exe, cwd, name, inside)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("-tmux: %w", err)
+	}
+	if inside {
+		return nil
+	}
+	cmd = exec.Command("tmux", "attach-session", "-t", name)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// tmuxArgs returns the tmux command that creates a window (or a detached
+// session, if not inside tmux) called name with a pane for each of the
+// argsList. Each pane runs exe with its args in dir. The panes are kept open
+// after wgo exits so that its last words can still be read.
+func tmuxArgs(argsList [][]string, exe, dir, name string, inside bool) []string {
+	pane := func(args []string) string {
+		return "env " + tmuxEnv + "=1 " + shellQuote(exe, args...)
+	}
+	var target []string
+	var tmuxArgs []string
+	if inside {
+		tmuxArgs = []string{"new-window", "-n", name, "-c", dir, pane(argsList[0])}
+	} else {
+		target = []string{"-t", name}
+		tmuxArgs = []string{"new-session", "-d", "-s", name, "-c", dir, pane(argsList[0])}
+	}
+	tmuxArgs = append(tmuxArgs, ";", "set-window-option")
+	tmuxArgs = append(tmuxArgs, target...)
+	tmuxArgs = append(tmuxArgs, "remain-on-exit", "on")
+	for _, args := range argsList[1:] {
+		tmuxArgs = append(tmuxArgs, ";", "split-window")
+		tmuxArgs = append(tmuxArgs, target...)
+		tmuxArgs = append(tmuxArgs, "-c", dir, pane(args))
+		// Re-tile after every split, otherwise tmux runs out of room for
+		// the panes after a few splits.
+		tmuxArgs = append(tmuxArgs, ";", "select-layout")
+		tmuxArgs = append(tmuxArgs, target...)
+		tmuxArgs = append(tmuxArgs, "tiled")
+	}
+	return tmuxArgs
+}
+
+// isTmuxPane reports whether the current process is a wgo started in a tmux
+// pane by -tmux.
+func isTmuxPane() bool {
+	return os.Getenv(tmuxEnv) != ""
+}
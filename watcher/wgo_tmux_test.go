@@ -0,0 +1,40 @@
+package watcher
+
+import (
+	"testing"
+)
+
+func Test_tmuxArgs(t *testing.T) {
+	t.Parallel()
+	argsList := splitWgoArgs([]string{
+		"wgo", "-tmux", "run", "./cmd/api", "::", "wgo", "-file", ".css", "npm", "run", "build", "::", "wgo", "echo", "it's",
+	})
+	t.Run("outside tmux", func(t *testing.T) {
+		t.Parallel()
+		got := tmuxArgs(argsList, "/usr/bin/wgo", "/src/app", "wgo-42", false)
+		want := []string{
+			"new-session", "-d", "-s", "wgo-42", "-c", "/src/app", "env WGO_TMUX=1 '/usr/bin/wgo' '-tmux' 'run' './cmd/api'",
+			";", "set-window-option", "-t", "wgo-42", "remain-on-exit", "on",
+			";", "split-window", "-t", "wgo-42", "-c", "/src/app", "env WGO_TMUX=1 '/usr/bin/wgo' '-file' '.css' 'npm' 'run' 'build'",
+			";", "select-layout", "-t", "wgo-42", "tiled",
+			";", "split-window", "-t", "wgo-42", "-c", "/src/app", `env WGO_TMUX=1 '/usr/bin/wgo' 'echo' 'it'\''s'`,
+			";", "select-layout", "-t", "wgo-42", "tiled",
+		}
+		if diff := Diff(got, want); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("inside tmux", func(t *testing.T) {
+		t.Parallel()
+		got := tmuxArgs(argsList[:2], "/usr/bin/wgo", "/src/app", "wgo-42", true)
+		want := []string{
+			"new-window", "-n", "wgo-42", "-c", "/src/app", "env WGO_TMUX=1 '/usr/bin/wgo' '-tmux' 'run' './cmd/api'",
+			";", "set-window-option", "remain-on-exit", "on",
+			";", "split-window", "-c", "/src/app", "env WGO_TMUX=1 '/usr/bin/wgo' '-file' '.css' 'npm' 'run' 'build'",
+			";", "select-layout", "tiled",
+		}
+		if diff := Diff(got, want); diff != "" {
+			t.Error(diff)
+		}
+	})
+}
@@ -0,0 +1,368 @@
+package watcher
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxPaneLines is how many lines of output a pane of the -tui dashboard keeps
+// for scrolling back.
+const maxPaneLines = 1000
+
+// tuiHelp is the footer of the -tui dashboard.
+const tuiHelp = " tab/1-9: select  ↑/↓ k/j: scroll  pgup/pgdn u/d: page  end/G: follow  r: restart  p: pause  q: quit"
+
+// statusColors are the colors of the statuses of the panes.
+var statusColors = map[string]string{
+	"building": "33",
+	"starting": "33",
+	"running":  "32",
+	"failed":   "31",
+	"exited":   "90",
+}
+
+// tuiDashboard is the -tui dashboard, which shows every parallel wgo command
+// in its own pane of the terminal along with its status.
+type tuiDashboard struct {
+	mu       sync.Mutex
+	panes    []*tuiPane
+	selected int
+	dirty    chan struct{}
+}
+
+// tuiPane is the pane of one wgo command in the -tui dashboard. It is an
+// io.Writer that the output of the command (and wgo's messages) is written to.
+type tuiPane struct {
+	dashboard *tuiDashboard
+	name      string
+	status    string
+	starts    int
+	started   time.Time
+	lines     []string
+	partial   []byte
+	scroll    int // How many lines the pane is scrolled up from the bottom.
+	rows      int // How many lines of output the pane showed when last drawn.
+
+	// keys is called with the keys that control the wgo command of the pane,
+	// 'r' and 'p'.
+	keys func(key byte)
+}
+
+// newTUIDashboard returns a tuiDashboard with one pane for each name.
+func newTUIDashboard(names []string) *tuiDashboard {
+	dashboard := &tuiDashboard{
+		dirty: make(chan struct{}, 1),
+	}
+	for _, name := range names {
+		dashboard.panes = append(dashboard.panes, &tuiPane{
+			dashboard: dashboard,
+			name:      name,
+			status:    "starting",
+		})
+	}
+	return dashboard
+}
+
+// changed tells the drawing loop that the dashboard needs to be drawn again.
+func (dashboard *tuiDashboard) changed() {
+	select {
+	case dashboard.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// Write implements io.Writer.
+func (pane *tuiPane) Write(p []byte) (n int, err error) {
+	pane.dashboard.mu.Lock()
+	defer pane.dashboard.mu.Unlock()
+	pane.partial = append(pane.partial, p...)
+	for {
+		i := bytes.IndexByte(pane.partial, '\n')
+		if i < 0 {
+			break
+		}
+		pane.lines = append(pane.lines, strings.TrimSuffix(string(pane.partial[:i]), "\r"))
+		pane.partial = pane.partial[i+1:]
+		// Keep a pane that is scrolled up showing the same lines.
+		if pane.scroll > 0 {
+			pane.scroll++
+		}
+	}
+	if len(pane.lines) > maxPaneLines {
+		pane.lines = append(pane.lines[:0], pane.lines[len(pane.lines)-maxPaneLines:]...)
+	}
+	pane.clampScroll()
+	pane.dashboard.changed()
+	return len(p), nil
+}
+
+// start reports that the wgo command of the pane is (re)starting its commands.
+func (pane *tuiPane) start(status string) {
+	pane.dashboard.mu.Lock()
+	defer pane.dashboard.mu.Unlock()
+	pane.status = status
+	pane.starts++
+	pane.started = time.Now()
+	pane.dashboard.changed()
+}
+
+// setStatus sets the status of the pane, such as "running" or "failed".
+func (pane *tuiPane) setStatus(status string) {
+	pane.dashboard.mu.Lock()
+	defer pane.dashboard.mu.Unlock()
+	pane.status = status
+	pane.dashboard.changed()
+}
+
+// clampScroll keeps the pane from being scrolled past its first line.
+func (pane *tuiPane) clampScroll() {
+	total := len(pane.lines)
+	if len(pane.partial) > 0 {
+		total++
+	}
+	if pane.scroll > total-1 {
+		pane.scroll = total - 1
+	}
+	if pane.scroll < 0 {
+		pane.scroll = 0
+	}
+}
+
+// render returns the escape sequences that draw the dashboard on a terminal
+// of the given size. The panes share the height of the terminal, minus the
+// last line which shows the keys.
+func (dashboard *tuiDashboard) render(width, height int) string {
+	dashboard.mu.Lock()
+	defer dashboard.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	rows := height - 1
+	for i, pane := range dashboard.panes {
+		paneRows := rows / len(dashboard.panes)
+		if i < rows%len(dashboard.panes) {
+			paneRows++
+		}
+		if paneRows == 0 {
+			continue
+		}
+		pane.renderHeader(&b, width, i == dashboard.selected)
+		b.WriteString("\x1b[K\r\n")
+		pane.rows = paneRows - 1
+		lines := pane.lines
+		if len(pane.partial) > 0 {
+			lines = append(lines[:len(lines):len(lines)], string(pane.partial))
+		}
+		end := len(lines) - pane.scroll
+		start := end - pane.rows
+		if start < 0 {
+			start = 0
+		}
+		for n := 0; n < pane.rows; n++ {
+			if start+n < end {
+				b.WriteString(truncateLine(cleanLine(lines[start+n]), width))
+			}
+			b.WriteString("\x1b[K\r\n")
+		}
+	}
+	b.WriteString("\x1b[2m" + truncateLine(tuiHelp, width) + "\x1b[0m\x1b[K\x1b[J")
+	return b.String()
+}
+
+// renderHeader writes the header line of the pane: its name, its status, when
+// it last (re)started and how far it is scrolled up. The header of the
+// selected pane is shown in reverse video.
+func (pane *tuiPane) renderHeader(b *strings.Builder, width int, selected bool) {
+	header := " " + pane.name + "  " + pane.status
+	if pane.starts > 0 {
+		verb := "restarted"
+		if pane.starts == 1 {
+			verb = "started"
+		}
+		header += "  " + verb + " " + pane.started.Format("15:04:05")
+	}
+	if pane.scroll > 0 {
+		header += "  ↑" + strconv.Itoa(pane.scroll)
+	}
+	header = truncateLine(header, width)
+	if selected {
+		b.WriteString("\x1b[7m" + header + strings.Repeat(" ", width-utf8.RuneCountInString(header)) + "\x1b[0m")
+		return
+	}
+	if color, ok := statusColors[pane.status]; ok {
+		header = strings.Replace(header, "  "+pane.status, "  \x1b["+color+"m"+pane.status+"\x1b[0m\x1b[1m", 1)
+	}
+	b.WriteString("\x1b[1m" + header + "\x1b[0m")
+}
+
+// cleanLine returns what a line of output looks like once it is printed:
+// terminal escape sequences are removed, tabs are expanded and only the text
+// after the last carriage return (as used by progress bars) is kept.
+func cleanLine(line string) string {
+	line = ansiEscapeRegexp.ReplaceAllString(line, "")
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	return strings.ReplaceAll(line, "\t", "    ")
+}
+
+// truncateLine cuts the line down to width characters.
+func truncateLine(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	if width <= 0 {
+		return ""
+	}
+	n := 0
+	for i := range line {
+		if n == width {
+			return line[:i]
+		}
+		n++
+	}
+	return line
+}
+
+// parseKey returns the first key in the input read from the terminal, and how
+// many bytes it took up. The arrow, page and home/end keys are returned by
+// name, every other key as itself.
+func parseKey(b []byte) (key string, size int) {
+	sequences := []struct {
+		sequence, key string
+	}{
+		{"\x1b[A", "up"}, {"\x1bOA", "up"},
+		{"\x1b[B", "down"}, {"\x1bOB", "down"},
+		{"\x1b[5~", "pgup"}, {"\x1b[6~", "pgdn"},
+		{"\x1b[H", "home"}, {"\x1b[1~", "home"}, {"\x1bOH", "home"},
+		{"\x1b[F", "end"}, {"\x1b[4~", "end"}, {"\x1bOF", "end"},
+	}
+	for _, s := range sequences {
+		if strings.HasPrefix(string(b), s.sequence) {
+			return s.key, len(s.sequence)
+		}
+	}
+	if b[0] == '\t' {
+		return "tab", 1
+	}
+	return string(b[:1]), 1
+}
+
+// handleKey handles a key pressed in the dashboard. It reports whether the
+// key asks to quit.
+func (dashboard *tuiDashboard) handleKey(key string) (quit bool) {
+	dashboard.mu.Lock()
+	defer dashboard.mu.Unlock()
+	defer dashboard.changed()
+	pane := dashboard.panes[dashboard.selected]
+	page := pane.rows / 2
+	if page < 1 {
+		page = 1
+	}
+	switch key {
+	case "q":
+		return true
+	case "tab":
+		dashboard.selected = (dashboard.selected + 1) % len(dashboard.panes)
+	case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+		if i := int(key[0] - '1'); i < len(dashboard.panes) {
+			dashboard.selected = i
+		}
+	case "up", "k":
+		pane.scroll++
+	case "down", "j":
+		pane.scroll--
+	case "pgup", "u":
+		pane.scroll += page
+	case "pgdn", "d":
+		pane.scroll -= page
+	case "home", "g":
+		pane.scroll = len(pane.lines)
+	case "end", "G":
+		pane.scroll = 0
+	case "r", "p":
+		if pane.keys != nil {
+			// Don't call into the wgo command while holding the lock, its
+			// messages are written to the pane.
+			keys := pane.keys
+			go keys(key[0])
+		}
+	}
+	pane.clampScroll()
+	return false
+}
+
+// startTUI shows the dashboard on the terminal out (in the alternate screen,
+// so that the terminal looks the same as before once wgo exits) and reads
+// the keys pressed from in, calling quit if 'q' is pressed. The returned
+// function stops the dashboard and restores the terminal.
+func startTUI(dashboard *tuiDashboard, out, in *os.File, quit func()) (stop func()) {
+	restore := func() {}
+	if isTerminal(in) {
+		if r, err := setCbreakMode(in); err == nil {
+			restore = r
+			go func() {
+				buf := make([]byte, 64)
+				for {
+					n, err := in.Read(buf)
+					if err != nil {
+						return
+					}
+					for keys := buf[:n]; len(keys) > 0; {
+						key, size := parseKey(keys)
+						keys = keys[size:]
+						if dashboard.handleKey(key) {
+							quit()
+						}
+					}
+				}
+			}()
+		}
+	}
+	supportsColor(out) // Enables the escape sequences on Windows.
+	_, _ = io.WriteString(out, "\x1b[?1049h\x1b[?25l")
+	resized := make(chan struct{}, 1)
+	stopResize := notifyResize(resized)
+	done := make(chan struct{})
+	drawn := make(chan struct{})
+	go func() {
+		defer close(drawn)
+		// Redraw at most every 50ms, so that a command that prints a lot
+		// doesn't keep the terminal busy.
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		dirty := true
+		for {
+			select {
+			case <-done:
+				return
+			case <-dashboard.dirty:
+				dirty = true
+			case <-resized:
+				dirty = true
+			case <-ticker.C:
+				if !dirty {
+					continue
+				}
+				dirty = false
+				width, height, ok := terminalSize(out)
+				if !ok {
+					width, height = 80, 24
+				}
+				_, _ = io.WriteString(out, dashboard.render(width, height))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-drawn
+		stopResize()
+		_, _ = io.WriteString(out, "\x1b[?25h\x1b[?1049l")
+		restore()
+	}
+}
@@ -0,0 +1,103 @@
+package watcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_tuiPane_Write(t *testing.T) {
+	t.Parallel()
+	dashboard := newTUIDashboard([]string{"api"})
+	pane := dashboard.panes[0]
+	pane.Write([]byte("foo\r\nba"))
+	pane.Write([]byte("r\nbaz"))
+	if diff := Diff([]string{"foo", "bar"}, pane.lines); diff != "" {
+		t.Error(diff)
+	}
+	if got, want := string(pane.partial), "baz"; got != want {
+		t.Errorf("\ngot:  %q\nwant: %q", got, want)
+	}
+	// A pane that is scrolled up keeps showing the same lines.
+	pane.scroll = 1
+	pane.Write([]byte("\nqux\n"))
+	if got, want := pane.scroll, 3; got != want {
+		t.Errorf("got scroll %d, want %d", got, want)
+	}
+	for i := 0; i < maxPaneLines; i++ {
+		pane.Write([]byte("line\n"))
+	}
+	if got, want := len(pane.lines), maxPaneLines; got != want {
+		t.Errorf("got %d lines, want %d", got, want)
+	}
+}
+
+func Test_tuiDashboard_render(t *testing.T) {
+	t.Parallel()
+	dashboard := newTUIDashboard([]string{"api", "web"})
+	dashboard.panes[0].Write([]byte("one\ntwo\nthree\n"))
+	dashboard.panes[1].status = "failed"
+	dashboard.panes[1].Write([]byte("\x1b[31merror\x1b[0m\tat main.go:5\n" + strings.Repeat("x", 30) + "\n"))
+	got := dashboard.render(20, 8)
+	want := "\x1b[H" +
+		"\x1b[7m api  starting      \x1b[0m\x1b[K\r\n" +
+		"one\x1b[K\r\n" +
+		"two\x1b[K\r\n" +
+		"three\x1b[K\r\n" +
+		"\x1b[1m web  \x1b[31mfailed\x1b[0m\x1b[1m\x1b[0m\x1b[K\r\n" +
+		"error    at main.go:\x1b[K\r\n" +
+		"xxxxxxxxxxxxxxxxxxxx\x1b[K\r\n" +
+		"\x1b[2m tab/1-9: select  ↑/\x1b[0m\x1b[K\x1b[J"
+	if diff := Diff(strings.Split(got, "\r\n"), strings.Split(want, "\r\n")); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_parseKey(t *testing.T) {
+	t.Parallel()
+	input := []byte("j\x1b[A\t\x1b[6~G")
+	var keys []string
+	for len(input) > 0 {
+		key, size := parseKey(input)
+		keys = append(keys, key)
+		input = input[size:]
+	}
+	if diff := Diff([]string{"j", "up", "tab", "pgdn", "G"}, keys); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func Test_tuiDashboard_handleKey(t *testing.T) {
+	t.Parallel()
+	dashboard := newTUIDashboard([]string{"api", "web"})
+	pane := dashboard.panes[1]
+	pane.Write([]byte(strings.Repeat("line\n", 20)))
+	pane.rows = 6
+	restarted := make(chan byte, 1)
+	pane.keys = func(key byte) { restarted <- key }
+	for _, key := range []string{"tab", "up", "pgup", "k"} {
+		if dashboard.handleKey(key) {
+			t.Fatalf("%q quit the dashboard", key)
+		}
+	}
+	if got, want := dashboard.selected, 1; got != want {
+		t.Errorf("got selected pane %d, want %d", got, want)
+	}
+	if got, want := pane.scroll, 5; got != want {
+		t.Errorf("got scroll %d, want %d", got, want)
+	}
+	dashboard.handleKey("g")
+	if got, want := pane.scroll, 19; got != want {
+		t.Errorf("got scroll %d, want %d", got, want)
+	}
+	dashboard.handleKey("end")
+	if got, want := pane.scroll, 0; got != want {
+		t.Errorf("got scroll %d, want %d", got, want)
+	}
+	dashboard.handleKey("r")
+	if got := <-restarted; got != 'r' {
+		t.Errorf("got key %q, want 'r'", got)
+	}
+	if !dashboard.handleKey("q") {
+		t.Error("q didn't quit the dashboard")
+	}
+}
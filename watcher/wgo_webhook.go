@@ -0,0 +1,109 @@
+package watcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// webhookEvent is the JSON payload posted to the webhooks. Text makes it a
+// valid Slack (or Mattermost, or Discord with /slack) incoming webhook
+// message as it is.
+type webhookEvent struct {
+	Event    string    `json:"event"` // "restart", "success" or "failure".
+	Text     string    `json:"text"`
+	Error    string    `json:"error,omitempty"`
+	Output   string    `json:"output,omitempty"`
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname,omitempty"`
+}
+
+// webhook posts events to a list of URLs in the background, in the order they
+// were sent.
+type webhook struct {
+	urls     []string
+	client   *http.Client
+	hostname string
+	stderr   io.Writer
+	events   chan webhookEvent
+	done     chan struct{}
+}
+
+// newWebhook returns a webhook that posts to the urls and reports failures to
+// stderr. It must be closed once it is no longer needed.
+func newWebhook(urls []string, stderr io.Writer) *webhook {
+	hostname, _ := os.Hostname()
+	hook := &webhook{
+		urls:     urls,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		hostname: hostname,
+		stderr:   stderr,
+		events:   make(chan webhookEvent, 16),
+		done:     make(chan struct{}),
+	}
+	go hook.run()
+	return hook
+}
+
+// send queues the event to be posted. If the webhooks are too slow to keep
+// up, the event is dropped rather than holding up the commands.
+func (hook *webhook) send(event webhookEvent) {
+	event.Time = time.Now()
+	event.Hostname = hook.hostname
+	select {
+	case hook.events <- event:
+	default:
+		fmt.Fprintln(hook.stderr, "[wgo] -webhook: too many events, dropping a "+event.Event+" event")
+	}
+}
+
+// close posts the queued events and stops the webhook.
+func (hook *webhook) close() {
+	close(hook.events)
+	<-hook.done
+}
+
+func (hook *webhook) run() {
+	defer close(hook.done)
+	for event := range hook.events {
+		b, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		for _, rawURL := range hook.urls {
+			err := hook.post(rawURL, b)
+			if err != nil {
+				fmt.Fprintln(hook.stderr, "[wgo] -webhook: "+err.Error())
+			}
+		}
+	}
+}
+
+// post posts the payload to rawURL. Webhook URLs usually contain a secret
+// token, so errors only mention the host.
+func (hook *webhook) post(rawURL string, payload []byte) error {
+	host := "webhook"
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	resp, err := hook.client.Post(rawURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %w", host, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded with %s", host, resp.Status)
+	}
+	return nil
+}
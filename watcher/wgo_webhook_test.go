@@ -0,0 +1,55 @@
+package watcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var events []webhookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type is %q, want application/json", got)
+		}
+		var event webhookEvent
+		err := json.NewDecoder(r.Body).Decode(&event)
+		if err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid token", http.StatusForbidden)
+	}))
+	defer failing.Close()
+
+	stderr := &Buffer{}
+	hook := newWebhook([]string{server.URL, failing.URL + "/services/SECRET"}, stderr)
+	hook.send(webhookEvent{Event: "restart", Text: "wgo: restarting"})
+	hook.send(webhookEvent{Event: "failure", Text: "wgo: go failed", Error: "go failed", Output: "./main.go:5:2: undefined: foo\n"})
+	hook.close()
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].Event != "restart" || events[1].Event != "failure" {
+		t.Errorf("got events %q and %q, want restart and failure", events[0].Event, events[1].Event)
+	}
+	if events[1].Output != "./main.go:5:2: undefined: foo\n" || events[1].Time.IsZero() {
+		t.Errorf("got %#v, want the output and the time of the failure", events[1])
+	}
+	// The failing webhook is reported without leaking its secret.
+	got := stderr.String()
+	if !strings.Contains(got, "[wgo] -webhook: "+strings.TrimPrefix(failing.URL, "http://")+" responded with 403 Forbidden") || strings.Contains(got, "SECRET") {
+		t.Errorf("unexpected stderr: %q", got)
+	}
+}